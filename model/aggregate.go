@@ -0,0 +1,154 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Aggregation describes the values computed by Aggregate
+type Aggregation struct {
+	// GroupBy is the field records are grouped by,
+	// all records form one group if empty
+	GroupBy string
+	// Field is the numeric or string field Sum, Min and Max
+	// are computed for. Only records are counted if empty.
+	Field string
+}
+
+// Group holds the values aggregated for records with the same GroupBy value
+type Group struct {
+	// Key is the value of the GroupBy field
+	Key   interface{}
+	Count int64
+	// Sum of numeric fields
+	Sum float64
+	// Min and Max of the field, nil if no records were aggregated
+	Min interface{}
+	Max interface{}
+}
+
+func (d *model) Aggregate(query Query, aggregation Aggregation) (groups []Group, err error) {
+	defer d.observe("aggregate", time.Now(), &err)
+	typ, err := d.aggregationType(aggregation)
+	if err != nil {
+		return nil, err
+	}
+	// only the aggregated fields are needed, so indexes
+	// with a projection can be read
+	if len(query.Fields) == 0 {
+		for _, field := range []string{aggregation.GroupBy, aggregation.Field} {
+			if len(field) > 0 {
+				query.Fields = append(query.Fields, field)
+			}
+		}
+	}
+	it, err := d.iterator(query, d.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	// the fields only pick the plan, records are decoded straight
+	// into the aggregation type instead of getting projected first
+	it.query.Fields = nil
+
+	// groups are kept in the order they are first seen,
+	// which is the index order when grouping by the index field
+	positions := map[interface{}]int{}
+	for {
+		rec, ok := it.nextRecord()
+		if !ok {
+			break
+		}
+		// decode only the aggregated fields
+		entry := reflect.New(typ)
+		err := json.Unmarshal(rec.Value, entry.Interface())
+		if err != nil {
+			return nil, err
+		}
+		var key interface{}
+		if len(aggregation.GroupBy) > 0 {
+			key = entry.Elem().Field(0).Interface()
+		}
+		pos, ok := positions[key]
+		if !ok {
+			pos = len(groups)
+			positions[key] = pos
+			groups = append(groups, Group{Key: key})
+		}
+		group := &groups[pos]
+		group.Count++
+		if len(aggregation.Field) > 0 {
+			group.add(entry.Elem().Field(entry.Elem().NumField() - 1))
+		}
+	}
+	return groups, it.Err()
+}
+
+// aggregationType returns a struct type with only the GroupBy
+// and Field fields of the model, in that order
+func (d *model) aggregationType(aggregation Aggregation) (reflect.Type, error) {
+	typ := d.typ
+	fields := []reflect.StructField{}
+	for _, name := range []string{aggregation.GroupBy, aggregation.Field} {
+		if len(name) == 0 {
+			continue
+		}
+		fieldName, err := structFieldName(typ, name)
+		if err != nil {
+			return nil, err
+		}
+		f, _ := typ.FieldByName(fieldName)
+		if name == aggregation.GroupBy && !f.Type.Comparable() {
+			return nil, fmt.Errorf("Can't group by field '%v' of type %v", name, f.Type)
+		}
+		if name == aggregation.Field {
+			switch f.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64, reflect.String:
+			default:
+				return nil, fmt.Errorf("Can't aggregate field '%v' of type %v", name, f.Type)
+			}
+		}
+		fields = append(fields, reflect.StructField{
+			Name: f.Name,
+			Type: f.Type,
+			Tag:  f.Tag,
+		})
+	}
+	if len(fields) == 2 && fields[0].Name == fields[1].Name {
+		fields = fields[:1]
+	}
+	return reflect.StructOf(fields), nil
+}
+
+func (g *Group) add(v reflect.Value) {
+	if v.Kind() == reflect.String {
+		if g.Min == nil || v.String() < g.Min.(string) {
+			g.Min = v.String()
+		}
+		if g.Max == nil || v.String() > g.Max.(string) {
+			g.Max = v.String()
+		}
+		return
+	}
+	f := toFloat(v)
+	g.Sum += f
+	if g.Min == nil || f < toFloat(reflect.ValueOf(g.Min)) {
+		g.Min = v.Interface()
+	}
+	if g.Max == nil || f > toFloat(reflect.ValueOf(g.Max)) {
+		g.Max = v.Interface()
+	}
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestAggregate(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		PageSize:  2,
+	})
+	users := []User{
+		{ID: "1", Tag: "rust", Age: 20, Created: 3},
+		{ID: "2", Tag: "go", Age: 30, Created: 1},
+		{ID: "3", Tag: "go", Age: 40, Created: 2},
+	}
+	for _, user := range users {
+		err := table.Save(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// groups in the order of the tag index
+	groups, err := table.Aggregate(Equals("tag", nil), Aggregation{GroupBy: "tag", Field: "age"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatal(groups)
+	}
+	if g := groups[0]; g.Key != "go" || g.Count != 2 || g.Sum != 70 || g.Min != 30 || g.Max != 40 {
+		t.Fatal(g)
+	}
+	if g := groups[1]; g.Key != "rust" || g.Count != 1 || g.Sum != 20 {
+		t.Fatal(g)
+	}
+
+	groups, err = table.Aggregate(Equals("tag", "go"), Aggregation{Field: "created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Key != nil || groups[0].Min != int64(1) || groups[0].Max != int64(2) {
+		t.Fatal(groups)
+	}
+
+	_, err = table.Aggregate(Equals("tag", nil), Aggregation{Field: "hasPet"})
+	if err == nil {
+		t.Fatal("Bool fields can't be aggregated")
+	}
+}
+
+func TestAggregateProjection(t *testing.T) {
+	byTag := ByEquality("tag")
+	byTag.Order.FieldName = "created"
+	byTag.Projection = []string{"title"}
+	table := New(fs.NewStore(), Article{}, Indexes(byTag), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	for i, tag := range []string{"go", "go", "rust"} {
+		err := table.Save(Article{ID: string(rune('1' + i)), Tag: tag, Content: "A long text", Created: int64(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only the projected index matches the query
+	groups, err := table.Aggregate(Equals("tag", "go"), Aggregation{Field: "created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Count != 2 || groups[0].Sum != 1 {
+		t.Fatal(groups)
+	}
+}
@@ -0,0 +1,338 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// BatchError is returned by batch operations when some of the items
+// failed. Errors has an entry for each item, nil for the ones that succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errors {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%v of %v items failed, first error: %v", failed, len(e.Errors), first)
+}
+
+func batchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+func (d *model) SaveMany(instances interface{}, opts ...SaveOption) (err error) {
+	defer d.observe("saveMany", time.Now(), &err)
+	v := reflect.ValueOf(instances)
+	if v.Kind() != reflect.Slice {
+		return errors.New("SaveMany expects a slice")
+	}
+	options := d.saveOptions(opts)
+	records := make([]interface{}, v.Len())
+	modes := make([]saveMode, v.Len())
+	errs := make([]error, v.Len())
+	for i := range records {
+		records[i], modes[i], errs[i] = d.prepare(v.Index(i).Interface(), saveModeUpsert)
+	}
+
+	// Items clashing with an earlier item of the batch fail without
+	// reading the store.
+	ids := map[string]bool{}
+	uniques := map[string]bool{}
+	for i, instance := range records {
+		if errs[i] != nil {
+			continue
+		}
+		id := fmt.Sprint(getFieldValue(instance, d.options.IdIndex.FieldName))
+		if ids[id] {
+			errs[i] = ErrorAlreadyExists
+			continue
+		}
+		keys := []string{}
+		for _, index := range d.indexes {
+			if !index.Unique {
+				continue
+			}
+			k := fmt.Sprintf("%v:%v", indexPrefix(index), getFieldValue(instance, index.FieldName))
+			if uniques[k] {
+				errs[i] = ErrorUniqueIndexViolation
+				break
+			}
+			keys = append(keys, k)
+		}
+		if errs[i] != nil {
+			continue
+		}
+		ids[id] = true
+		for _, k := range keys {
+			uniques[k] = true
+		}
+	}
+
+	// the stored records and the records holding the unique
+	// values of the batch are read for all items at once
+	stored, err := d.readValues(d.options.IdIndex, records, errs)
+	if err != nil {
+		return err
+	}
+	holders := map[string]map[string][]*store.Record{}
+	for _, index := range d.indexes {
+		if index.Unique {
+			holders[index.Name()], err = d.readValues(index, records, errs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Items taking a unique value another item of the batch gives up
+	// wait for that item to be saved, so they are saved in rounds
+	// until no item is left waiting. Items still waiting then, ie.
+	// swapping values, fail.
+	todo := []int{}
+	for i := range records {
+		if errs[i] == nil {
+			todo = append(todo, i)
+		}
+	}
+	saved := map[string]interface{}{}
+	for len(todo) > 0 {
+		waiting := []int{}
+		for _, i := range todo {
+			err := d.saveBatchItem(records[i], modes[i], stored, holders, ids, saved, options)
+			if err == errHolderPending {
+				waiting = append(waiting, i)
+				continue
+			}
+			id := fmt.Sprint(getFieldValue(records[i], d.options.IdIndex.FieldName))
+			delete(ids, id)
+			if err == nil {
+				saved[id] = records[i]
+			}
+			errs[i] = err
+		}
+		if len(waiting) == len(todo) {
+			for _, i := range waiting {
+				errs[i] = ErrorUniqueIndexViolation
+			}
+			break
+		}
+		todo = waiting
+	}
+	return batchError(errs)
+}
+
+// errHolderPending is returned for batch items taking a unique value
+// held by another item of the batch which isn't saved yet
+var errHolderPending = errors.New("Holder of the unique value is not saved yet")
+
+// saveBatchItem saves an item of SaveMany with the stored records and
+// the holders of unique values read for the batch. Holders which are
+// items of the batch saved with another value gave the value up,
+// clashes between items are checked before.
+func (d *model) saveBatchItem(instance interface{}, mode saveMode, stored map[string][]*store.Record, holders map[string]map[string][]*store.Record, pending map[string]bool, saved map[string]interface{}, options SaveOptions) error {
+	var rec *store.Record
+	var oldEntry interface{}
+	switch recs := stored[d.valuePrefix(d.options.IdIndex, instance)]; len(recs) {
+	case 0:
+	case 1:
+		var err error
+		rec = recs[0]
+		oldEntry, err = d.decode(rec)
+		if err != nil {
+			return err
+		}
+	default:
+		return ErrorMultipleRecordsFound
+	}
+	id := getFieldValue(instance, d.options.IdIndex.FieldName)
+	for _, index := range d.uniqueChecks(instance, oldEntry) {
+		value := getFieldValue(instance, index.FieldName)
+		for _, holder := range holders[index.Name()][d.valuePrefix(index, instance)] {
+			holderID, err := d.decodeID(holder.Value)
+			if err != nil {
+				return err
+			}
+			if reflect.DeepEqual(holderID, id) {
+				continue
+			}
+			k := fmt.Sprint(holderID)
+			if entry, ok := saved[k]; ok && !reflect.DeepEqual(getFieldValue(entry, index.FieldName), value) {
+				continue
+			}
+			if pending[k] {
+				return errHolderPending
+			}
+			return ErrorUniqueIndexViolation
+		}
+	}
+	return d.saveOver(instance, rec, oldEntry, mode, options, false)
+}
+
+func (d *model) ReadMany(ids []interface{}, resultSlicePointer interface{}) (err error) {
+	defer d.observe("readMany", time.Now(), &err)
+	slice := reflect.ValueOf(resultSlicePointer).Elem()
+	results := reflect.MakeSlice(slice.Type(), len(ids), len(ids))
+	errs := make([]error, len(ids))
+	entries := make([]interface{}, len(ids))
+	for i, id := range ids {
+		entries[i] = reflect.New(d.typ).Interface()
+		setFieldValue(entries[i], d.options.IdIndex.FieldName, id)
+	}
+	found, err := d.readValues(d.options.IdIndex, entries, errs)
+	if err != nil {
+		return err
+	}
+	for i := range ids {
+		recs := found[d.valuePrefix(d.options.IdIndex, entries[i])]
+		if d.options.SoftDelete {
+			recs = withoutDeleted(recs)
+		}
+		switch len(recs) {
+		case 0:
+			errs[i] = ErrorNotFound
+			continue
+		case 1:
+		default:
+			errs[i] = ErrorMultipleRecordsFound
+			continue
+		}
+		entry := reflect.New(slice.Type().Elem())
+		errs[i] = json.Unmarshal(recs[0].Value, entry.Interface())
+		if errs[i] == nil {
+			results.Index(i).Set(entry.Elem())
+		}
+	}
+	slice.Set(results)
+	return batchError(errs)
+}
+
+// valuePrefix returns the prefix of the keys holding the
+// value of the index field of the entry
+func (d *model) valuePrefix(i Index, entry interface{}) string {
+	return d.queryToListKey(i, i.ToQuery(getFieldValue(entry, i.FieldName)))
+}
+
+// readValues reads the records holding the values of the index field
+// of the entries, by the prefix of their keys. Entries with an error
+// are skipped.
+//
+// The store can only read keys one prefix at a time, so the keys with
+// the prefix common to all values are read in pages, in order, as long
+// as the pages contain the values. The values left are read one by one,
+// so values spread over a large index don't read all of it.
+func (d *model) readValues(i Index, entries []interface{}, errs []error) (map[string][]*store.Record, error) {
+	prefixes := []string{}
+	found := map[string][]*store.Record{}
+	for j, entry := range entries {
+		if errs[j] != nil {
+			continue
+		}
+		p := d.valuePrefix(i, entry)
+		if _, ok := found[p]; !ok {
+			found[p] = nil
+			prefixes = append(prefixes, p)
+		}
+	}
+	sort.Strings(prefixes)
+	if len(prefixes) > 1 {
+		common := commonPrefix(prefixes[0], prefixes[len(prefixes)-1])
+		pageSize := d.pageSize()
+		offset := uint(0)
+		for len(prefixes) > 0 {
+			recs, err := d.storeReadPage(i, common, pageSize, offset)
+			if err != nil {
+				return nil, err
+			}
+			offset += uint(len(recs))
+			matched := false
+			for _, rec := range recs {
+				// keys are sorted, so the prefixes before the key are done
+				for len(prefixes) > 0 && rec.Key > prefixes[0] && !strings.HasPrefix(rec.Key, prefixes[0]) {
+					prefixes = prefixes[1:]
+				}
+				if len(prefixes) > 0 && strings.HasPrefix(rec.Key, prefixes[0]) {
+					found[prefixes[0]] = append(found[prefixes[0]], rec)
+					matched = true
+				}
+			}
+			if uint(len(recs)) < pageSize {
+				prefixes = nil
+			}
+			if !matched {
+				break
+			}
+		}
+	}
+	for _, p := range prefixes {
+		recs, err := d.storeRead(i, p)
+		if err != nil {
+			return nil, err
+		}
+		found[p] = recs
+	}
+	return found, nil
+}
+
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+func (d *model) DeleteMany(ids []interface{}) (err error) {
+	defer d.observe("deleteMany", time.Now(), &err)
+	errs := make([]error, len(ids))
+	entries := make([]interface{}, len(ids))
+	for i, id := range ids {
+		entries[i] = reflect.New(d.typ).Interface()
+		setFieldValue(entries[i], d.options.IdIndex.FieldName, id)
+	}
+	found, err := d.readValues(d.options.IdIndex, entries, errs)
+	if err != nil {
+		return err
+	}
+	deleted := map[string]bool{}
+	for i, id := range ids {
+		// ids listed more than once are deleted once
+		if deleted[fmt.Sprint(id)] {
+			continue
+		}
+		deleted[fmt.Sprint(id)] = true
+		switch recs := found[d.valuePrefix(d.options.IdIndex, entries[i])]; len(recs) {
+		case 0:
+			errs[i] = ErrorNotFound
+		case 1:
+			var oldEntry interface{}
+			oldEntry, errs[i] = d.decode(recs[0])
+			if errs[i] == nil {
+				errs[i] = d.deleteRecord(recs[0], oldEntry)
+			}
+		default:
+			errs[i] = ErrorMultipleRecordsFound
+		}
+	}
+	return batchError(errs)
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestBatch(t *testing.T) {
+	tag := ByEquality("tag")
+	tag.Unique = true
+	table := New(fs.NewStore(), User{}, Indexes(tag), &ModelOptions{
+		Namespace:   uuid.Must(uuid.NewV4()).String(),
+		IdGenerator: TimeOrdered(),
+	})
+	users := []*User{
+		{Tag: "go"},
+		{Tag: "rust"},
+		// clashes with the first user
+		{Tag: "go"},
+		{ID: "x", Tag: "c"},
+	}
+	err := table.SaveMany(users)
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatal(err)
+	}
+	if batchErr.Errors[0] != nil || batchErr.Errors[1] != nil ||
+		batchErr.Errors[2] != ErrorUniqueIndexViolation || batchErr.Errors[3] != nil {
+		t.Fatal(batchErr.Errors)
+	}
+	// generated ids are set on the pointers
+	if users[0].ID == "" || users[1].ID == "" || users[0].ID == users[1].ID {
+		t.Fatal(users[0], users[1])
+	}
+
+	// saving records again doesn't clash with themselves
+	users[0].Age = 30
+	err = table.SaveMany([]*User{users[0], users[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []User{}
+	err = table.ReadMany([]interface{}{"x", "missing", users[0].ID}, &results)
+	batchErr, ok = err.(*BatchError)
+	if !ok {
+		t.Fatal(err)
+	}
+	if batchErr.Errors[1] != ErrorNotFound {
+		t.Fatal(batchErr.Errors)
+	}
+	if len(results) != 3 || results[0].Tag != "c" || results[1].ID != "" || results[2].Age != 30 {
+		t.Fatal(results)
+	}
+
+	err = table.DeleteMany([]interface{}{users[0].ID, "x", users[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.ReadMany([]interface{}{users[0].ID, users[1].ID}, &results)
+	batchErr, ok = err.(*BatchError)
+	if !ok || batchErr.Errors[0] != ErrorNotFound || batchErr.Errors[1] != nil {
+		t.Fatal(err)
+	}
+
+	// items can take unique values other items of the batch give up
+	err = table.SaveMany([]*User{{ID: "a", Tag: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.SaveMany([]*User{{ID: "b", Tag: "x"}, {ID: "a", Tag: "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.ReadMany([]interface{}{"a", "b"}, &results)
+	if err != nil || results[0].Tag != "y" || results[1].Tag != "x" {
+		t.Fatal(err, results)
+	}
+
+	// a value is only given up if the item giving it up gets saved
+	err = table.SaveMany([]*User{{ID: "c", Tag: "z"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.SaveMany([]*User{{ID: "d", Tag: "y"}, {ID: "a", Tag: "z"}})
+	batchErr, ok = err.(*BatchError)
+	if !ok || batchErr.Errors[0] != ErrorUniqueIndexViolation || batchErr.Errors[1] != ErrorUniqueIndexViolation {
+		t.Fatal(err)
+	}
+	err = table.Read(Equals("tag", "y"), &results[0])
+	if err != nil || results[0].ID != "a" {
+		t.Fatal(err, results[0])
+	}
+
+	// swapping values would need one of them held twice
+	err = table.SaveMany([]*User{{ID: "a", Tag: "z"}, {ID: "c", Tag: "y"}})
+	batchErr, ok = err.(*BatchError)
+	if !ok || batchErr.Errors[0] != ErrorUniqueIndexViolation || batchErr.Errors[1] != ErrorUniqueIndexViolation {
+		t.Fatal(err)
+	}
+}
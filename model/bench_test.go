@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func benchmarkTable() Model {
+	tag := ByEquality("tag")
+	tag.Unique = true
+	created := ByEquality("created")
+	created.Order.Type = OrderTypeDesc
+	return New(fs.NewStore(), User{}, Indexes(tag, created, ByEquality("age")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+}
+
+func BenchmarkSave(b *testing.B) {
+	table := benchmarkTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// updates the same records to keep the store small
+		id := fmt.Sprint(i % 100)
+		err := table.Save(User{ID: id, Tag: id, Age: i, Created: int64(i)})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	table := benchmarkTable()
+	for i := 0; i < 100; i++ {
+		err := table.Save(User{ID: fmt.Sprint(i), Tag: fmt.Sprint(i)})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		user := User{}
+		err := table.Read(Equals("tag", fmt.Sprint(i%100)), &user)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndexToKey(b *testing.B) {
+	table := benchmarkTable().(*model)
+	user := &User{ID: "1", Tag: "go", Created: 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, index := range table.indexes {
+			table.indexToKey(index, "1", user, true)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// Cache is an in-process LRU cache of store reads.
+// A cache can be shared between models, keys contain the namespace.
+type Cache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+	// generation is increased by every invalidation, reads started
+	// in an older generation might be stale so they are not cached
+	generation uint64
+}
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Entries currently in the cache
+	Entries int
+}
+
+type cacheEntry struct {
+	key     string
+	records []*store.Record
+	// read is when the records were read, their expiry is relative to it
+	read time.Time
+	// expires is zero for entries without a time limit
+	expires time.Time
+}
+
+// NewCache creates a cache holding at most size reads,
+// each for at most ttl. Zero ttl means no time limit.
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Stats returns the hit and miss counts of the cache
+func (c *Cache) Stats() CacheStats {
+	c.Lock()
+	defer c.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+func (c *Cache) get(key string) ([]*store.Record, bool) {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(el)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	return entry.remaining(), true
+}
+
+// remaining returns the records with the time left to live as expiry
+func (e *cacheEntry) remaining() []*store.Record {
+	elapsed := time.Since(e.read)
+	ret := make([]*store.Record, len(e.records))
+	for i, rec := range e.records {
+		ret[i] = rec
+		if rec.Expiry > 0 {
+			cp := *rec
+			cp.Expiry -= elapsed
+			ret[i] = &cp
+		}
+	}
+	return ret
+}
+
+// currentGeneration returns the generation to pass to set
+// with the records read after calling it
+func (c *Cache) currentGeneration() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.generation
+}
+
+// set caches records read in a generation, unless keys were
+// invalidated since then. Entries expire with the first record.
+func (c *Cache) set(key string, records []*store.Record, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	entry := &cacheEntry{
+		key:     key,
+		records: records,
+		read:    now,
+	}
+	if c.ttl > 0 {
+		entry.expires = now.Add(c.ttl)
+	}
+	for _, rec := range records {
+		if rec.Expiry > 0 && (entry.expires.IsZero() || now.Add(rec.Expiry).Before(entry.expires)) {
+			entry.expires = now.Add(rec.Expiry)
+		}
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.size > 0 && c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate removes every cached read the written or deleted key
+// could have been returned by, ie. all the prefixes of the key.
+// @todo this goes through all entries, group them by index
+// if it turns out to be slow for big caches.
+func (c *Cache) invalidate(key string) {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	for k, el := range c.entries {
+		if strings.HasPrefix(key, k) {
+			c.remove(el)
+		}
+	}
+}
+
+// invalidatePrefix removes every cached read of keys with the prefix,
+// ie. the ones of a dropped tenant, and the reads they could have been
+// returned by.
+func (c *Cache) invalidatePrefix(prefix string) {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	for k, el := range c.entries {
+		if strings.HasPrefix(k, prefix) || strings.HasPrefix(prefix, k) {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
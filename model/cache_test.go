@@ -0,0 +1,117 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache(10, time.Minute)
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Cache:     cache,
+	})
+	err := table.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []User{}
+	for i := 0; i < 2; i++ {
+		err = table.List(Equals("tag", "go"), &users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 {
+			t.Fatal(users)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 {
+		t.Fatal(stats)
+	}
+
+	// saving a record with the same tag invalidates the listing
+	err = table.Save(User{ID: "2", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.List(Equals("tag", "go"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatal(users)
+	}
+
+	idQuery := Equals("ID", "1")
+	idQuery.Order.Type = OrderTypeUnordered
+	err = table.Delete(idQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatal(users)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache := NewCache(1, 0)
+	cache.set("a", nil, 0)
+	cache.set("b", nil, 0)
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("a should be evicted")
+	}
+	if _, ok := cache.get("b"); !ok {
+		t.Fatal("b should be cached")
+	}
+	stats := cache.Stats()
+	if stats.Evictions != 1 || stats.Entries != 1 {
+		t.Fatal(stats)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	cache := NewCache(10, 0)
+	table := New(fs.NewStore(), User{}, nil, &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Cache:     cache,
+	})
+	err := table.Save(User{ID: "1"}, WithTTL(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{}
+	for i := 0; i < 2; i++ {
+		err = table.Read(Equals("ID", "1"), &user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.Stats().Hits != 1 {
+		t.Fatal(cache.Stats())
+	}
+	// cached reads expire with their records
+	time.Sleep(150 * time.Millisecond)
+	err = table.Read(Equals("ID", "1"), &user)
+	if err != ErrorNotFound {
+		t.Fatalf("Expected the record to be expired, got %v", err)
+	}
+}
+
+func TestCacheStaleSet(t *testing.T) {
+	cache := NewCache(10, 0)
+	generation := cache.currentGeneration()
+	// a write invalidates while the read is in flight
+	cache.invalidate("users:1")
+	cache.set("users:", nil, generation)
+	if _, ok := cache.get("users:"); ok {
+		t.Fatal("Records read before an invalidation should not be cached")
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/context/metadata"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestWithContext(t *testing.T) {
+	tenants := []string{}
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Hooks: Hooks{
+			BeforeSave: []Hook{func(ctx context.Context, record interface{}) error {
+				tenant, _ := metadata.Get(ctx, "Micro-Namespace")
+				tenants = append(tenants, tenant)
+				return nil
+			}},
+		},
+	})
+	ctx := metadata.Set(context.Background(), "Micro-Namespace", "blog")
+	err := table.WithContext(ctx).Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 1 || tenants[0] != "blog" {
+		t.Fatal(tenants)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := table.WithContext(ctx).Watch(Equals("tag", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err = table.WithContext(ctx).Save(User{ID: "2", Tag: "go"})
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+	users := []User{}
+	err = table.WithContext(ctx).List(Equals("tag", "go"), &users)
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+	// the watcher gets stopped with the context
+	for range w.Chan() {
+	}
+
+	err = table.List(Equals("tag", "go"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatal(users)
+	}
+}
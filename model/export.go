@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"time"
+)
+
+func (d *model) Export(w io.Writer) (err error) {
+	defer d.observe("export", time.Now(), &err)
+	it, err := d.iterator(d.options.IdIndex.ToQuery(nil), d.pageSize())
+	if err != nil {
+		return err
+	}
+	for {
+		rec, ok := it.nextRecord()
+		if !ok {
+			return it.Err()
+		}
+		// values are stored as json already
+		_, err = w.Write(append(rec.Value, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *model) Import(r io.Reader) (err error) {
+	defer d.observe("import", time.Now(), &err)
+	dec := json.NewDecoder(r)
+	typ := d.typ
+	batch := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(typ)), 0, int(d.pageSize()))
+	// errs has an entry for each line read
+	errs := []error{}
+	for {
+		entry := reflect.New(typ)
+		decodeErr := dec.Decode(entry.Interface())
+		if decodeErr == nil {
+			batch = reflect.Append(batch, entry)
+		}
+		// records before a failing line get saved
+		if batch.Len() == int(d.pageSize()) || (decodeErr != nil && batch.Len() > 0) {
+			batchErrs, err := d.importBatch(batch)
+			if err != nil {
+				return err
+			}
+			errs = append(errs, batchErrs...)
+			batch = batch.Slice(0, 0)
+		}
+		if decodeErr == io.EOF {
+			return batchError(errs)
+		}
+		if decodeErr != nil {
+			return batchError(append(errs, decodeErr))
+		}
+		// stop after the batch with the first failing record
+		if batch.Len() == 0 && batchError(errs) != nil {
+			return batchError(errs)
+		}
+	}
+}
+
+// importBatch saves a batch of imported records, building all their
+// index keys, and returns the error of each record
+func (d *model) importBatch(batch reflect.Value) ([]error, error) {
+	err := d.SaveMany(batch.Interface())
+	if err == nil {
+		return make([]error, batch.Len()), nil
+	}
+	if batchErr, ok := err.(*BatchError); ok {
+		return batchErr.Errors, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestExportImport(t *testing.T) {
+	tag := ByEquality("tag")
+	tag.Unique = true
+	from := New(fs.NewStore(), User{}, Indexes(tag), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		PageSize:  2,
+	})
+	for _, user := range []User{{ID: "1", Tag: "a"}, {ID: "2", Tag: "b"}, {ID: "3", Tag: "c"}} {
+		err := from.Save(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := from.Export(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 {
+		t.Fatal(lines)
+	}
+
+	to := New(fs.NewStore(), User{}, Indexes(tag), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		PageSize:  2,
+	})
+	err = to.Import(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// secondary indexes are built
+	user := User{}
+	err = to.Read(Equals("tag", "c"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "3" {
+		t.Fatal(user)
+	}
+
+	// the fourth line is in the same batch as the failing third line,
+	// the fifth line isn't imported
+	err = to.Import(strings.NewReader(`{"id":"4","tag":"d"}` + "\n" + `{"id":"5","tag":"e"}` + "\n" +
+		`{"id":"6","tag":"a"}` + "\n" + `{"id":"7","tag":"f"}` + "\n" + `{"id":"9","tag":"g"}` + "\n"))
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatal(err)
+	}
+	if len(batchErr.Errors) != 4 || batchErr.Errors[2] != ErrorUniqueIndexViolation || batchErr.Errors[3] != nil {
+		t.Fatal(batchErr.Errors)
+	}
+	err = to.Read(Equals("ID", "7"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = to.Read(Equals("ID", "9"), &user)
+	if err != ErrorNotFound {
+		t.Fatal(err)
+	}
+
+	err = to.Import(strings.NewReader(`{"id":"8"}` + "\n" + `{"id":`))
+	batchErr, ok = err.(*BatchError)
+	if !ok || len(batchErr.Errors) != 2 || batchErr.Errors[0] != nil || batchErr.Errors[1] == nil {
+		t.Fatal(err)
+	}
+	err = to.Read(Equals("ID", "8"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
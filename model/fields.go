@@ -0,0 +1,172 @@
+package model
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Field lookups, index names and key encoders are cached per type and index,
+// as looking them up by name on every save is costly.
+var (
+	fieldIndexes  sync.Map
+	indexPrefixes sync.Map
+	jsonNameSets  sync.Map
+)
+
+type fieldKey struct {
+	typ  reflect.Type
+	name string
+}
+
+type indexKey struct {
+	typ        string
+	fieldName  string
+	orderField string
+	orderType  OrderType
+	projection string
+}
+
+// fieldIndex returns the index of the field of a struct type the
+// same way FieldByName(strings.Title(name)) finds it, cached
+func fieldIndex(typ reflect.Type, name string) ([]int, bool) {
+	k := fieldKey{typ, name}
+	if index, ok := fieldIndexes.Load(k); ok {
+		return index.([]int), index.([]int) != nil
+	}
+	var index []int
+	if f, ok := typ.FieldByName(strings.Title(name)); ok {
+		index = f.Index
+	}
+	fieldIndexes.Store(k, index)
+	return index, index != nil
+}
+
+// field returns the field of a struct or pointer to struct value
+func field(v reflect.Value, name string) reflect.Value {
+	v = reflect.Indirect(v)
+	index, ok := fieldIndex(v.Type(), name)
+	if !ok {
+		panic("bug in code, field " + name + " not found in " + v.Type().String())
+	}
+	return v.FieldByIndex(index)
+}
+
+// keyEncoder encodes the field values of an index in its keys
+type keyEncoder struct {
+	// filter is the index of the filter field, nil if the
+	// filter value is not part of the keys
+	filter       []int
+	encodeFilter func(v reflect.Value) string
+	order        []int
+	// encodeOrder escapes the values it encodes
+	encodeOrder func(v reflect.Value) string
+}
+
+type encoderKey struct {
+	typ   reflect.Type
+	index indexKey
+	// options changing the encoding of order values
+	padLength  int
+	base32     bool
+	floatFmt   string
+	float32Max float32
+	float64Max float64
+}
+
+var (
+	keyEncoders       sync.Map
+	stringType        = reflect.TypeOf("")
+	int64Type         = reflect.TypeOf(int64(0))
+	intType           = reflect.TypeOf(0)
+	int32Type         = reflect.TypeOf(int32(0))
+	float32Type       = reflect.TypeOf(float32(0))
+	float64Type       = reflect.TypeOf(float64(0))
+	boolType          = reflect.TypeOf(false)
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// keyEncoderOf returns the key encoder of an index for a struct type,
+// built once, so keys are encoded without looking up fields or
+// switching on the types of their values
+func keyEncoderOf(typ reflect.Type, i Index) *keyEncoder {
+	k := encoderKey{
+		typ:        typ,
+		index:      indexKey{i.Type, i.FieldName, i.Order.FieldName, i.Order.Type, strings.Join(i.Projection, ",")},
+		padLength:  i.StringOrderPadLength,
+		base32:     i.Base32Encode,
+		floatFmt:   i.FloatFormat,
+		float32Max: i.Float32Max,
+		float64Max: i.Float64Max,
+	}
+	if enc, ok := keyEncoders.Load(k); ok {
+		return enc.(*keyEncoder)
+	}
+	orderName := orderField(i.Order, i.FieldName)
+	order, ok := fieldIndex(typ, orderName)
+	if !ok {
+		panic("bug in code, field " + orderName + " not found in " + typ.String())
+	}
+	enc := &keyEncoder{
+		order:       order,
+		encodeOrder: orderEncoder(i, typ.FieldByIndex(order).Type),
+	}
+	if i.Type == indexTypeEq && i.FieldName != i.Order.FieldName && i.Order.FieldName != "" {
+		filter, ok := fieldIndex(typ, i.FieldName)
+		if !ok {
+			panic("bug in code, field " + i.FieldName + " not found in " + typ.String())
+		}
+		enc.filter = filter
+		enc.encodeFilter = filterEncoder(typ.FieldByIndex(filter).Type)
+	}
+	keyEncoders.Store(k, enc)
+	return enc
+}
+
+// compile builds the key encoders and names of all indexes when
+// the model is created, so saves only hit the caches. It also builds
+// the type used to decode only the id of records.
+func (d *model) compile() {
+	for _, index := range append(d.indexes[:len(d.indexes):len(d.indexes)], d.options.IdIndex) {
+		_, filterOK := fieldIndex(d.typ, index.FieldName)
+		_, orderOK := fieldIndex(d.typ, orderField(index.Order, index.FieldName))
+		// missing fields are reported by check
+		if filterOK && orderOK {
+			keyEncoderOf(d.typ, index)
+		}
+		indexPrefix(index)
+	}
+	fieldName, err := structFieldName(d.typ, d.options.IdIndex.FieldName)
+	if err != nil {
+		return
+	}
+	f, _ := d.typ.FieldByName(fieldName)
+	d.idType = reflect.StructOf([]reflect.StructField{{
+		Name: f.Name,
+		Type: f.Type,
+		Tag:  f.Tag,
+	}})
+}
+
+// decodeID decodes only the id of a record
+func (d *model) decodeID(value []byte) (interface{}, error) {
+	if d.idType == nil {
+		entry := reflect.New(d.typ).Interface()
+		err := json.Unmarshal(value, entry)
+		if err != nil {
+			return nil, err
+		}
+		return getFieldValue(entry, d.options.IdIndex.FieldName), nil
+	}
+	entry := reflect.New(d.idType)
+	err := json.Unmarshal(value, entry.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return entry.Elem().Field(0).Interface(), nil
+}
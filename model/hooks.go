@@ -0,0 +1,103 @@
+package model
+
+import (
+	"context"
+	"reflect"
+)
+
+// Hook is a function run around saves and deletes.
+// The record is always a pointer so hooks can modify it,
+// ie. set an updated timestamp or normalize a slug.
+// An error returned from a before hook aborts the operation.
+// The context is the one passed to WithContext.
+type Hook func(ctx context.Context, record interface{}) error
+
+// Hooks set up for a model, run in the order they are listed,
+// after the hook methods of the record itself.
+type Hooks struct {
+	BeforeSave   []Hook
+	AfterSave    []Hook
+	BeforeDelete []Hook
+	AfterDelete  []Hook
+}
+
+// BeforeSaver can be implemented by records to run
+// logic before they get saved.
+type BeforeSaver interface {
+	BeforeSave(ctx context.Context) error
+}
+
+// AfterSaver can be implemented by records to run
+// logic after they got saved.
+type AfterSaver interface {
+	AfterSave(ctx context.Context) error
+}
+
+// BeforeDeleter can be implemented by records to run
+// logic before they get deleted.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleter can be implemented by records to run
+// logic after they got deleted.
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// addressable returns a pointer to the instance, copying non pointer
+// instances, so hooks and generated ids can modify them.
+func addressable(instance interface{}) interface{} {
+	v := reflect.ValueOf(instance)
+	if v.Kind() == reflect.Ptr {
+		return instance
+	}
+	cp := reflect.New(v.Type())
+	cp.Elem().Set(v)
+	return cp.Interface()
+}
+
+func runHooks(ctx context.Context, hooks []Hook, record interface{}) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *model) beforeSave(record interface{}) error {
+	if h, ok := record.(BeforeSaver); ok {
+		if err := h.BeforeSave(d.ctx); err != nil {
+			return err
+		}
+	}
+	return runHooks(d.ctx, d.options.Hooks.BeforeSave, record)
+}
+
+func (d *model) afterSave(record interface{}) error {
+	if h, ok := record.(AfterSaver); ok {
+		if err := h.AfterSave(d.ctx); err != nil {
+			return err
+		}
+	}
+	return runHooks(d.ctx, d.options.Hooks.AfterSave, record)
+}
+
+func (d *model) beforeDelete(record interface{}) error {
+	if h, ok := record.(BeforeDeleter); ok {
+		if err := h.BeforeDelete(d.ctx); err != nil {
+			return err
+		}
+	}
+	return runHooks(d.ctx, d.options.Hooks.BeforeDelete, record)
+}
+
+func (d *model) afterDelete(record interface{}) error {
+	if h, ok := record.(AfterDeleter); ok {
+		if err := h.AfterDelete(d.ctx); err != nil {
+			return err
+		}
+	}
+	return runHooks(d.ctx, d.options.Hooks.AfterDelete, record)
+}
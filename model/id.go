@@ -0,0 +1,131 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// IDGenerator generates ids for records saved without one.
+// The store passed reads and writes the database and table of the
+// id index. The returned value gets converted to the type of the
+// id field, so ie. an int64 returned for an int id field is fine
+// and integers are formatted in base 10 for string id fields.
+type IDGenerator func(s store.Store, namespace string) (interface{}, error)
+
+// AutoIncrement generates int64 ids from a sequence saved in the store
+// under the namespace of the model.
+// The sequence is only safe for concurrent use inside a single process,
+// multiple instances saving at the same time might get the same id.
+// Records with generated ids are created rather than upserted, so
+// the save of a clashing id fails with ErrorAlreadyExists.
+func AutoIncrement() IDGenerator {
+	var mtx sync.Mutex
+	return func(s store.Store, namespace string) (interface{}, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		key := fmt.Sprintf("%v:sequence", namespace)
+		var current int64
+		recs, err := s.Read(key)
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+		if len(recs) > 0 {
+			current, err = strconv.ParseInt(string(recs[0].Value), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		current++
+		err = s.Write(&store.Record{
+			Key:   key,
+			Value: []byte(strconv.FormatInt(current, 10)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return current, nil
+	}
+}
+
+// TimeOrdered generates string ids that sort in the order they were
+// generated in, ie. listing an ordered id index returns the oldest records first.
+// The ids consist of a zero padded unix nano timestamp and a random suffix
+// to avoid clashes between processes.
+func TimeOrdered() IDGenerator {
+	var mtx sync.Mutex
+	var last int64
+	return func(s store.Store, namespace string) (interface{}, error) {
+		mtx.Lock()
+		now := time.Now().UnixNano()
+		// keep ids monotonic even if the clock did not move on
+		if now <= last {
+			now = last + 1
+		}
+		last = now
+		mtx.Unlock()
+
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("%019d%v", now, hex.EncodeToString(suffix)), nil
+	}
+}
+
+// ensureID sets a generated id on the instance if the id is
+// the zero value and an IdGenerator is configured, and returns
+// true if it did.
+// Non pointer instances get copied, so the generated id
+// will only be visible to the caller when saving pointers.
+func (d *model) ensureID(instance interface{}) (interface{}, bool, error) {
+	if d.options.IdGenerator == nil {
+		return instance, false, nil
+	}
+	id := reflect.ValueOf(getFieldValue(instance, d.options.IdIndex.FieldName))
+	if !id.IsZero() {
+		return instance, false, nil
+	}
+	if err := d.check(); err != nil {
+		return nil, false, err
+	}
+	db, table := d.tableOf(d.options.IdIndex)
+	generated, err := d.options.IdGenerator(&tableStore{Store: d.store, database: db, table: table}, d.tenantNamespace())
+	if err != nil {
+		return nil, false, err
+	}
+	instance = addressable(instance)
+	setFieldValue(instance, d.options.IdIndex.FieldName, generated)
+	return instance, true, nil
+}
+
+// tableStore reads and writes a database and table of a store
+// unless the options passed say otherwise
+type tableStore struct {
+	store.Store
+	database string
+	table    string
+}
+
+func (t *tableStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	return t.Store.Read(key, append([]store.ReadOption{store.ReadFrom(t.database, t.table)}, opts...)...)
+}
+
+func (t *tableStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	return t.Store.Write(r, append([]store.WriteOption{store.WriteTo(t.database, t.table)}, opts...)...)
+}
+
+func (t *tableStore) Delete(key string, opts ...store.DeleteOption) error {
+	return t.Store.Delete(key, append([]store.DeleteOption{store.DeleteFrom(t.database, t.table)}, opts...)...)
+}
+
+func (t *tableStore) List(opts ...store.ListOption) ([]string, error) {
+	return t.Store.List(append([]store.ListOption{store.ListFrom(t.database, t.table)}, opts...)...)
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// ErrorStopIteration can be returned from the function passed
+// to Iterate to stop iterating without an error
+var ErrorStopIteration = errors.New("stop iteration")
+
+// DefaultPageSize is the number of keys read from the
+// store at once by Iterate and Iterator
+const DefaultPageSize = 100
+
+// Iterator reads the records matching a query one by one
+type Iterator interface {
+	// Next reads the next record into resultPointer. It returns false
+	// once there are no more records or reading failed, see Err.
+	Next(resultPointer interface{}) bool
+	// Err returns the error that stopped the iteration, if any
+	Err() error
+}
+
+type iterator struct {
+	d     *model
+	query Query
+	plan  *Plan
+	// pageSize is the number of keys read at once,
+	// zero reads all keys at once
+	pageSize uint
+	// offset of the next page in the store
+	offset uint
+	page   []*store.Record
+	pos    int
+	done   bool
+	err    error
+	// skipped records of the query offset and returned
+	// records of the query limit
+	skipped  int64
+	returned int64
+}
+
+func (d *model) Iterator(query Query) (Iterator, error) {
+	return d.iterator(query, d.pageSize())
+}
+
+func (d *model) Iterate(query Query, fn func(record interface{}) error) (err error) {
+	defer d.observe("iterate", time.Now(), &err)
+	it, err := d.iterator(query, d.pageSize())
+	if err != nil {
+		return err
+	}
+	for {
+		entry := reflect.New(d.typ).Interface()
+		if !it.Next(entry) {
+			return it.Err()
+		}
+		err = fn(entry)
+		if err == ErrorStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *model) pageSize() uint {
+	if d.options.PageSize > 0 {
+		return uint(d.options.PageSize)
+	}
+	return DefaultPageSize
+}
+
+func (d *model) iterator(query Query, pageSize uint) (*iterator, error) {
+	plan, err := d.plan(query)
+	if err != nil {
+		return nil, err
+	}
+	// results of several ranges and sorted results
+	// can only be read at once
+	if len(plan.Plans) > 0 || len(plan.Ranges) != 1 || plan.Sort {
+		pageSize = 0
+	}
+	it := &iterator{
+		d:     d,
+		query: query,
+		plan:  plan,
+	}
+	// the store skips the offset and stops at the limit,
+	// unless records are filtered after reading them
+	if (pageSize > 0 || query.Limit > 0) && len(plan.Plans) == 0 && len(plan.Ranges) == 1 &&
+		!plan.Scan && !plan.Sort && (!d.options.SoftDelete || query.IncludeDeleted) {
+		it.offset = uint(query.Offset)
+		it.skipped = query.Offset
+		if query.Limit > 0 && (pageSize == 0 || uint(query.Limit) < pageSize) {
+			pageSize = uint(query.Limit)
+		}
+	}
+	it.pageSize = pageSize
+	return it, nil
+}
+
+func (it *iterator) Next(resultPointer interface{}) bool {
+	rec, ok := it.nextRecord()
+	if !ok {
+		return false
+	}
+	// fields missing from the value are left with their zero value
+	v := reflect.Indirect(reflect.ValueOf(resultPointer))
+	v.Set(reflect.Zero(v.Type()))
+	it.err = json.Unmarshal(rec.Value, resultPointer)
+	return it.err == nil
+}
+
+// nextRecord returns the next raw record, reading pages as needed
+func (it *iterator) nextRecord() (*store.Record, bool) {
+	for {
+		if it.err != nil {
+			return nil, false
+		}
+		if it.query.Limit > 0 && it.returned >= it.query.Limit {
+			return nil, false
+		}
+		if it.pos < len(it.page) {
+			rec := it.page[it.pos]
+			it.pos++
+			if it.skipped < it.query.Offset {
+				it.skipped++
+				continue
+			}
+			it.returned++
+			return rec, true
+		}
+		if it.done {
+			return nil, false
+		}
+		it.page, it.err = it.nextPage()
+		it.pos = 0
+	}
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+// nextPage reads the next page of records matching the query.
+// Pages might be empty once filtered, but are never the last one
+// unless they were read in full.
+func (it *iterator) nextPage() ([]*store.Record, error) {
+	d := it.d
+	if it.pageSize == 0 {
+		it.done = true
+		recs, err := d.execute(it.plan, it.query)
+		if err != nil {
+			return nil, err
+		}
+		return d.finish(recs, it.query)
+	}
+	recs, err := d.storeReadPage(it.plan.Index, it.plan.Ranges[0].Prefix, it.pageSize, it.offset)
+	if err != nil {
+		return nil, err
+	}
+	it.offset += uint(len(recs))
+	if uint(len(recs)) < it.pageSize {
+		it.done = true
+	}
+	if it.plan.Scan {
+		recs, err = d.filter(recs, it.query, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d.finish(recs, it.query)
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestIterate(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("age")), &ModelOptions{
+		Namespace:  uuid.Must(uuid.NewV4()).String(),
+		PageSize:   2,
+		Metrics:    metrics,
+		SoftDelete: true,
+	})
+	for i := 1; i <= 5; i++ {
+		err := table.Save(User{ID: fmt.Sprintf("%v", i), Age: 30 + i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := table.Delete(Equals("ID", "4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	err = table.Iterate(Equals("age", nil), func(record interface{}) error {
+		ids = append(ids, record.(*User).ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 5]" {
+		t.Fatal(ids)
+	}
+	if reads := metrics.StoreCall(table.(*model).namespace, indexPrefix(ByEquality("age")), "read").Count; reads != 3 {
+		t.Fatalf("Expected 3 pages read, got %v", reads)
+	}
+
+	// early exit
+	ids = []string{}
+	err = table.Iterate(Equals("age", nil), func(record interface{}) error {
+		ids = append(ids, record.(*User).ID)
+		if len(ids) == 2 {
+			return ErrorStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatal(ids)
+	}
+
+	q := Equals("age", nil)
+	q.Offset = 1
+	q.Limit = 2
+	it, err := table.Iterator(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = []string{}
+	user := User{}
+	for it.Next(&user) {
+		ids = append(ids, user.ID)
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if fmt.Sprint(ids) != "[2 3]" {
+		t.Fatal(ids)
+	}
+
+	users := []*User{}
+	err = table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != "2" || users[1].ID != "3" {
+		t.Fatal(users)
+	}
+
+	// unordered scans are filtered page by page
+	q = Equals("hasPet", false)
+	q.Order.Type = OrderTypeUnordered
+	q.AllowFiltering = true
+	plan, err := table.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Scan || plan.Sort {
+		t.Fatal(plan)
+	}
+	ids = []string{}
+	err = table.Iterate(q, func(record interface{}) error {
+		ids = append(ids, record.(*User).ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 {
+		t.Fatal(ids)
+	}
+}
+
+func TestIteratorFields(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("age")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	for i, tag := range []string{"go", ""} {
+		err := table.Save(User{ID: fmt.Sprint(i), Age: i, Tag: tag})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := Equals("age", nil)
+	q.Fields = []string{"id", "age"}
+	it, err := table.Iterator(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{Tag: "left over"}
+	for it.Next(&user) {
+		if user.Tag != "" {
+			t.Fatalf("Fields not selected should be zero, got %v", user)
+		}
+		user.Tag = "left over"
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("age")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Metrics:   metrics,
+	})
+	for i := 0; i < 10; i++ {
+		err := table.Save(User{ID: fmt.Sprint(i), Age: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := Equals("age", nil)
+	q.Offset = 3
+	q.Limit = 2
+	users := []User{}
+	err := table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Age != 3 || users[1].Age != 4 {
+		t.Fatal(users)
+	}
+	// the offset and limit are applied by the store
+	if keys := metrics.StoreCall(table.(*model).namespace, indexPrefix(ByEquality("age")), "read").Keys; keys != 2 {
+		t.Fatalf("Expected 2 keys read, got %v", keys)
+	}
+}
@@ -0,0 +1,28 @@
+package model
+
+import "strings"
+
+// Separators in key components are escaped so values like urls or
+// times can't collide with other keys. ':' becomes ";0" and ';' becomes
+// ";1". As ':' and ';' are adjacent characters, escaped keys sort
+// the same way as the values they were built from.
+var (
+	keyEscaper   = strings.NewReplacer(";", ";1", ":", ";0")
+	keyUnescaper = strings.NewReplacer(";1", ";", ";0", ":")
+)
+
+// escapeKey escapes a key component
+func escapeKey(s string) string {
+	if !strings.ContainsAny(s, ":;") {
+		return s
+	}
+	return keyEscaper.Replace(s)
+}
+
+// unescapeKey reverses escapeKey
+func unescapeKey(s string) string {
+	if !strings.Contains(s, ";") {
+		return s
+	}
+	return keyUnescaper.Replace(s)
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/context/metadata"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestEscapeKey(t *testing.T) {
+	values := []string{"a", "a:b", "a;b", "a9", "a<", "a;1", "a;0", ":", ";"}
+	escaped := []string{}
+	for _, v := range values {
+		e := escapeKey(v)
+		if unescapeKey(e) != v {
+			t.Fatalf("%v escaped to %v unescaped to %v", v, e, unescapeKey(e))
+		}
+		escaped = append(escaped, e)
+	}
+	// escaping preserves the order of values
+	sort.Strings(values)
+	sort.Strings(escaped)
+	for i := range values {
+		if escapeKey(values[i]) != escaped[i] {
+			t.Fatalf("Order differs at %v: %v %v", i, values, escaped)
+		}
+	}
+}
+
+func TestPadInt(t *testing.T) {
+	for _, n := range []int64{0, 5, -5, math.MaxInt64, math.MinInt64, math.MinInt32} {
+		if padInt(n) != fmt.Sprintf("%019d", n) {
+			t.Fatalf("%v padded to %v", n, padInt(n))
+		}
+	}
+}
+
+func TestKeyEncoder(t *testing.T) {
+	type record struct {
+		ID    string
+		Score int32
+		Ref   interface{}
+	}
+	byScore := ByEquality("score")
+	byScore.Order.Type = OrderTypeDesc
+	byRef := ByEquality("ref")
+	table := New(fs.NewStore(), record{}, Indexes(byScore, byRef), &ModelOptions{
+		Namespace: "records",
+	}).(*model)
+	rec := record{ID: "a:1", Score: -1, Ref: int64(3)}
+	// the int32 difference wraps around
+	if k := table.indexToKey(byScore, rec.ID, rec, true); k != "records:v2:eqByScoreDescByScore:-000000002147483648:a;01" {
+		t.Fatal(k)
+	}
+	// interface fields are encoded by the type of the value they hold
+	if k := table.indexToKey(byRef, rec.ID, rec, true); k != "records:v2:eqByRefAscByRef:0000000000000000003:a;01" {
+		t.Fatal(k)
+	}
+}
+
+func TestSeparatorsInValues(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Tenant:    TenantFromMetadata("Micro-Namespace"),
+	})
+	// tenants can contain separators too
+	blog := table.WithContext(metadata.Set(context.Background(), "Micro-Namespace", "blog:1"))
+	for _, user := range []User{
+		{ID: "1", Tag: "https://a"},
+		{ID: "2:1", Tag: "https:"},
+		{ID: "3", Tag: "https;"},
+	} {
+		err := blog.Save(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users := []User{}
+	err := blog.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[0].ID != "2:1" || users[1].ID != "1" || users[2].ID != "3" {
+		t.Fatal(users)
+	}
+	user := User{}
+	err = blog.Read(Equals("tag", "https://a"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "1" {
+		t.Fatal(user)
+	}
+
+	tenants, err := table.Tenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 1 || tenants[0] != "blog:1" {
+		t.Fatal(tenants)
+	}
+	err = table.DropTenant("blog:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = blog.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Fatal(users)
+	}
+}
@@ -6,21 +6,30 @@
 package model
 
 import (
+	"context"
+	"encoding"
 	"encoding/base32"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
+	"github.com/micro/micro/v3/service/logger"
 	"github.com/micro/micro/v3/service/store"
 )
 
 var (
 	ErrorNotFound             = errors.New("not found")
+	ErrorAlreadyExists        = errors.New("already exists")
 	ErrorMultipleRecordsFound = errors.New("multiple records found")
+	ErrorUniqueIndexViolation = errors.New("Unique index violation")
 )
 
 type OrderType string
@@ -32,8 +41,10 @@ const (
 )
 
 const (
-	queryTypeEq = "eq"
-	indexTypeEq = "eq"
+	queryTypeEq  = "eq"
+	queryTypeAnd = "and"
+	queryTypeOr  = "or"
+	indexTypeEq  = "eq"
 )
 
 func defaultIndex() Index {
@@ -51,53 +62,241 @@ type model struct {
 	indexes   []Index
 	options   ModelOptions
 	instance  interface{}
+	// typ is the type of instance
+	typ reflect.Type
+	// idType is a struct type with only the id field, see decodeID
+	idType reflect.Type
+	// watchers are shared between the copies made by WithContext
+	watchers *watchers
+	// ctx is checked for cancellation before every store call
+	// and passed to hooks, see WithContext
+	ctx context.Context
+	// tenant resolved from ctx, see ModelOptions.Tenant
+	tenant    string
+	tenantErr error
 }
 
 // Model represents a place where data can be saved to and
 // queried from.
 type Model interface {
 	// Save any object. Maintains indexes set up.
-	Save(interface{}) error
+	// Save creates the record or overwrites the existing one with the same id.
+	Save(instance interface{}, opts ...SaveOption) error
+	// Create saves a new record, fails with ErrorAlreadyExists if a
+	// record with the same id exists.
+	Create(instance interface{}, opts ...SaveOption) error
+	// Update saves an existing record, fails with ErrorNotFound if no
+	// record with the same id exists.
+	Update(instance interface{}, opts ...SaveOption) error
+	// Patch updates only the given fields of the record matching an
+	// Equals("id", value) query. Keys are field names, see MaskedFields
+	// for building the fields from a protobuf FieldMask.
+	// The remaining time to live of the record is kept unless a new one is passed.
+	// Only index keys with a changed key or value are written, indexes
+	// without a projection store the whole record so they are always written.
+	Patch(query Query, fields map[string]interface{}, opts ...SaveOption) error
 	// List objects by a query. Each query requires an appropriate index
-	// to exist. List throws an error if a matching index can't be found.
+	// to exist. List throws an error if a matching index can't be found,
+	// unless the query allows filtering.
 	List(query Query, resultSlicePointer interface{}) error
+	// Iterate calls fn with a pointer to each record matching the query.
+	// Records are read from the store in pages of PageSize keys, except
+	// for And and Or queries and queries sorted in process, which are
+	// read at once. Returning ErrorStopIteration from fn stops iterating.
+	Iterate(query Query, fn func(record interface{}) error) error
+	// Iterator returns a pull style iterator reading pages
+	// of records like Iterate
+	Iterator(query Query) (Iterator, error)
 	// Same as list, but accepts pointer to non slices and
 	// expects to find only one element. Throws error if not found
 	// or if more than two elements are found.
 	Read(query Query, resultPointer interface{}) error
 	// Deletes a record. Delete only support Equals("id", value) for now.
-	// @todo Delete only supports string keys for now.
+	// The order type of the query is ignored, only the field name and value
+	// are used to look up the record by the id index.
 	Delete(query Query) error
+	// SaveMany saves a slice of records like Save. Items failing are
+	// reported in a *BatchError, the others are saved. Uniqueness is
+	// checked within the batch before reading the store. The stored
+	// records and unique values are read for the whole batch in pages,
+	// keys are written one by one as the store has no batch writes.
+	SaveMany(instances interface{}, opts ...SaveOption) error
+	// ReadMany reads records by id into a slice with an element for each id.
+	// Ids not found are left with the zero value and reported as ErrorNotFound
+	// in a *BatchError. The ids are read in pages like SaveMany.
+	ReadMany(ids []interface{}, resultSlicePointer interface{}) error
+	// DeleteMany deletes records by id like Delete, failures
+	// are reported in a *BatchError. The ids are read in pages
+	// like SaveMany.
+	DeleteMany(ids []interface{}) error
+	// Aggregate counts the records matching a query and computes the sum,
+	// minimum and maximum of a field, per value of the GroupBy field.
+	// Records are read in pages like Iterate and only the aggregated
+	// fields are decoded.
+	Aggregate(query Query, aggregation Aggregation) ([]Group, error)
+	// Export writes all records to w as JSON Lines, one record per line,
+	// reading them from the id index in pages. Soft deleted records
+	// and expiry times are not exported.
+	Export(w io.Writer) error
+	// Import saves the records read from JSON Lines written by Export,
+	// building the keys of all indexes. Records are saved in batches of
+	// PageSize like SaveMany, import stops after the batch with the first
+	// failing record. The other records of that batch are still saved.
+	// Failures are returned in a *BatchError with an entry for each line
+	// read, ie. Errors[0] is the error of the first line.
+	Import(r io.Reader) error
+	// Reindex moves the records written by versions of this package
+	// before keys were versioned to the current key layout, building
+	// the keys of all indexes and deleting the old ones. See Upgrading
+	// in the README.
+	Reindex() error
+	// Restore brings back a soft deleted record. Accepts the same
+	// queries as Delete. Returns ErrorNotFound if there is no
+	// deleted record matching the query.
+	Restore(query Query) error
+	// Purge removes soft deleted records for good that were
+	// deleted longer than olderThan ago.
+	Purge(olderThan time.Duration) error
+	// Explain returns the plan a query would be executed with,
+	// ie. the index and the key ranges read
+	Explain(query Query) (*Plan, error)
+	// Watch delivers events of records matching a query,
+	// ie. Equals("tag", "go") or Equals("tag", nil) for all records.
+	Watch(query Query) (Watcher, error)
+	// WithContext returns a copy of the model bound to the context.
+	// Operations of the copy stop between store calls once the context
+	// is done, the context is passed to hooks and metadata of the context
+	// is added to log fields, see LogMetadata.
+	// Watchers of the copy are stopped when the context is done.
+	WithContext(ctx context.Context) Model
+	// Tenants lists the tenants of a model with a tenant resolver
+	Tenants() ([]string, error)
+	// DropTenant deletes all records of a tenant
+	DropTenant(tenant string) error
+}
+
+func (d *model) WithContext(ctx context.Context) Model {
+	cp := *d
+	cp.ctx = ctx
+	cp.resolveTenant()
+	return &cp
 }
 
 type ModelOptions struct {
+	// Debug logs store calls at info level instead of debug level
 	Debug     bool
 	IdIndex   Index
 	Namespace string
+	// IdGenerator is called on Save when the id field of the
+	// record is the zero value. See AutoIncrement and TimeOrdered.
+	// Pass a pointer to Save to get the generated id back.
+	IdGenerator IDGenerator
+	// TTL is the default time to live of saved records.
+	// Zero means records never expire. Can be overridden per save with WithTTL.
+	TTL time.Duration
+	// SoftDelete makes Delete mark records as deleted instead of
+	// removing them. Deleted records are hidden from Read and List
+	// unless the query has IncludeDeleted set, and can be brought back
+	// with Restore or removed for good with Purge.
+	SoftDelete bool
+	// Stream to publish create, update and delete events to.
+	// Failing to publish is logged, it doesn't fail the operation.
+	Stream Publisher
+	// Topic events are published to, defaults to the namespace.
+	Topic string
+	// Cache reads in process. Saves and deletes through the model
+	// invalidate the affected reads, writes made by other processes are
+	// only seen once cached reads expire.
+	Cache *Cache
+	// Logger store calls are logged to, defaults to logger.DefaultLogger
+	Logger logger.Logger
+	// LogLevel store calls are logged at, ie. logger.TraceLevel. Nil means
+	// the default, which is logger.DebugLevel or logger.InfoLevel with Debug set.
+	LogLevel *logger.Level
+	// RedactValue returns the loggable form of values read and written,
+	// and of the field values in the keys logged. Values are not logged by
+	// default as they might contain personal data, only their size is.
+	RedactValue func(value []byte) string
+	// Database the keys of the model are stored in,
+	// defaults to the database of the store
+	Database string
+	// Table the keys of the model are stored in. Keys in their own table
+	// are not prefixed with the namespace. Defaults to the table of the store.
+	Table string
+	// TablePerIndex stores the keys of each index in their own table,
+	// named after Table and the index. Only used when Table is set.
+	TablePerIndex bool
+	// Tenant resolves the tenant of each operation from the context
+	// passed to WithContext. Operations fail if no tenant is found.
+	// See TenantFromMetadata and TenantFromAccount.
+	Tenant TenantResolver
+	// LogMetadata are the keys of the context metadata added
+	// to log fields, defaults to DefaultLogMetadata
+	LogMetadata []string
+	// Metrics gets notified of operations and store calls, see MemoryMetrics
+	Metrics Metrics
+	// PageSize is the number of keys Iterate and Iterator read
+	// from the store at once, defaults to DefaultPageSize.
+	// Pages are not cached.
+	PageSize int
+	// Hooks run around Save, Create, Update, Patch and Delete.
+	// Records can also implement BeforeSaver, AfterSaver,
+	// BeforeDeleter and AfterDeleter.
+	Hooks Hooks
+}
+
+type SaveOptions struct {
+	// TTL of the record and all of its index entries
+	TTL time.Duration
+}
+
+type SaveOption func(o *SaveOptions)
+
+// WithTTL sets the time to live of the saved record and all
+// of its index entries, which will expire together.
+func WithTTL(ttl time.Duration) SaveOption {
+	return func(o *SaveOptions) {
+		o.TTL = ttl
+	}
+}
+
+func (d *model) saveOptions(opts []SaveOption) SaveOptions {
+	options := SaveOptions{
+		TTL: d.options.TTL,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
 }
 
 func New(store store.Store, instance interface{}, indexes []Index, options *ModelOptions) Model {
-	debug := false
-	var idIndex Index
-	namespace := reflect.TypeOf(instance).String()
+	opts := ModelOptions{}
 	if options != nil {
-		debug = options.Debug
-		if options.IdIndex.Type != "" {
-			idIndex = options.IdIndex
-		}
-
-		if len(options.Namespace) > 0 {
-			namespace = options.Namespace
-		}
+		opts = *options
+	}
+	if opts.IdIndex.Type == "" {
+		opts.IdIndex = defaultIndex()
 	}
-	if idIndex.Type == "" {
-		idIndex = defaultIndex()
+	namespace := reflect.TypeOf(instance).String()
+	if len(opts.Namespace) > 0 {
+		namespace = opts.Namespace
+	}
+	m := &model{
+		store:     store,
+		namespace: namespace,
+		indexes:   indexes,
+		options:   opts,
+		instance:  instance,
+		typ:       reflect.TypeOf(instance),
+		watchers: &watchers{
+			m: map[string]*watcher{},
+		},
+		ctx: context.Background(),
 	}
-	return &model{
-		store, namespace, indexes, ModelOptions{
-			Debug:   debug,
-			IdIndex: idIndex,
-		}, instance}
+	m.compile()
+	m.resolveTenant()
+	return m
 }
 
 type Index struct {
@@ -122,6 +321,12 @@ type Index struct {
 	FloatFormat string
 	Float64Max  float64
 	Float32Max  float32
+
+	// Projection lists the fields stored in the keys of the index,
+	// all fields are stored if empty. The id, filter and order fields
+	// are always stored. Indexes with a projection are only read by
+	// queries selecting a subset of the stored fields with Query.Fields.
+	Projection []string
 }
 
 type Order struct {
@@ -163,10 +368,22 @@ func ByEquality(fieldName string) Index {
 
 type Query struct {
 	Index
-	Order  Order
-	Value  interface{}
+	Order Order
+	Value interface{}
+	// Offset is the number of matching records skipped
 	Offset int64
-	Limit  int64
+	// Limit is the maximum number of records returned, zero means no limit
+	Limit int64
+	// IncludeDeleted returns soft deleted records too
+	IncludeDeleted bool
+	// AllowFiltering lets queries no index can serve read all
+	// records and filter them in process, see Explain
+	AllowFiltering bool
+	// Queries combined by And or Or
+	Queries []Query
+	// Fields returned by Read and List, all fields if empty.
+	// Other fields of the results are left with their zero value.
+	Fields []string
 }
 
 // Equals is an equality query by `fieldName`
@@ -189,43 +406,209 @@ func Equals(fieldName string, value interface{}) Query {
 	}
 }
 
-func (d *model) Save(instance interface{}) error {
-	// @todo replace this hack with reflection
-	js, err := json.Marshal(instance)
+// And is a query matching the records that match all queries,
+// ie. And(Equals("tag", "go"), Equals("author", "alice")).
+// Each query is read from its own index and the results are intersected.
+// Results are in the order of the first query.
+func And(queries ...Query) Query {
+	return Query{
+		Index: Index{
+			Type: queryTypeAnd,
+		},
+		Queries: queries,
+	}
+}
+
+// Or is a query matching the records that match any of the queries.
+// Each query is read from its own index, the results are deduplicated
+// and returned in the order of the first query, unless Order is changed.
+func Or(queries ...Query) Query {
+	q := Query{
+		Index: Index{
+			Type: queryTypeOr,
+		},
+		Queries: queries,
+	}
+	if len(queries) > 0 {
+		q.Order = queries[0].Order
+	}
+	return q
+}
+
+// In is a query matching the records where `fieldName`
+// equals to any of the values, ie. In("id", "1", "2").
+func In(fieldName string, values ...interface{}) Query {
+	queries := []Query{}
+	for _, value := range values {
+		queries = append(queries, Equals(fieldName, value))
+	}
+	q := Or(queries...)
+	q.Order = Order{
+		FieldName: fieldName,
+		Type:      OrderTypeAsc,
+	}
+	return q
+}
+
+type saveMode int
+
+const (
+	saveModeUpsert saveMode = iota
+	saveModeCreate
+	saveModeUpdate
+)
+
+func (d *model) Save(instance interface{}, opts ...SaveOption) (err error) {
+	defer d.observe("save", time.Now(), &err)
+	return d.saveWithMode(instance, saveModeUpsert, d.saveOptions(opts))
+}
+
+func (d *model) Create(instance interface{}, opts ...SaveOption) (err error) {
+	defer d.observe("create", time.Now(), &err)
+	return d.saveWithMode(instance, saveModeCreate, d.saveOptions(opts))
+}
+
+func (d *model) Update(instance interface{}, opts ...SaveOption) (err error) {
+	defer d.observe("update", time.Now(), &err)
+	return d.saveWithMode(instance, saveModeUpdate, d.saveOptions(opts))
+}
+
+func (d *model) saveWithMode(instance interface{}, mode saveMode, options SaveOptions) error {
+	instance, mode, err := d.prepare(instance, mode)
 	if err != nil {
 		return err
 	}
+	return d.saveRecord(instance, mode, options)
+}
 
+// prepare generates the id of an instance and runs the
+// before save hooks on a pointer to it. The returned mode creates
+// records with generated ids, so a clashing id isn't overwritten.
+func (d *model) prepare(instance interface{}, mode saveMode) (interface{}, saveMode, error) {
+	instance, generated, err := d.ensureID(instance)
+	if err != nil {
+		return nil, mode, err
+	}
+	if generated {
+		mode = saveModeCreate
+	}
+	// hooks get a pointer so they can modify the record
+	instance = addressable(instance)
+	return instance, mode, d.beforeSave(instance)
+}
+
+// saveRecord saves a prepared instance
+func (d *model) saveRecord(instance interface{}, mode saveMode, options SaveOptions) error {
 	// get the old entries so we can compare values
 	// @todo consider some kind of locking (even if it's not distributed) by key here
 	// to avoid 2 read-writes happening at the same time
-	idQuery := d.options.IdIndex.ToQuery(getFieldValue(instance, d.options.IdIndex.FieldName))
-
-	oldEntry := reflect.New(reflect.ValueOf(instance).Type()).Interface()
+	oldEntry := reflect.New(d.typ).Interface()
 
-	err = d.Read(idQuery, &oldEntry)
+	// soft deleted records are read too, so their stale index keys get removed
+	rec, err := d.readByID(getFieldValue(instance, d.options.IdIndex.FieldName), oldEntry)
 	if err != nil && err != ErrorNotFound {
 		return err
 	}
+	if rec == nil {
+		oldEntry = nil
+	}
+	return d.saveOver(instance, rec, oldEntry, mode, options, true)
+}
 
-	// Do uniqueness checks before saving any data
+// saveOver saves a prepared instance over the stored record decoded
+// into oldEntry, both nil if there is none. Unique values are checked
+// with checkUnique set, SaveMany checks them for the whole batch.
+func (d *model) saveOver(instance interface{}, rec *store.Record, oldEntry interface{}, mode saveMode, options SaveOptions, checkUnique bool) error {
+	// a soft deleted record still blocks creation until it gets purged
+	if rec != nil && mode == saveModeCreate {
+		return ErrorAlreadyExists
+	}
+	exists := rec != nil && !isDeleted(rec)
+	if !exists && mode == saveModeUpdate {
+		return ErrorNotFound
+	}
+	var uniqueChecks []Index
+	if checkUnique {
+		uniqueChecks = d.uniqueChecks(instance, oldEntry)
+	}
+	err := d.save(instance, oldEntry, d.indexes, uniqueChecks, options)
+	if err != nil {
+		return err
+	}
+	if exists {
+		d.notify(EventTypeUpdate, instance, oldEntry)
+	} else {
+		d.notify(EventTypeCreate, instance, nil)
+	}
+	return d.afterSave(instance)
+}
+
+// uniqueChecks returns the unique indexes the values of instance need
+// to be checked for. Unique values the record already had don't need
+// to be checked again.
+func (d *model) uniqueChecks(instance, oldEntry interface{}) []Index {
+	ret := []Index{}
 	for _, index := range d.indexes {
+		if index.Unique && (oldEntry == nil || indexChanged(index, oldEntry, instance)) {
+			ret = append(ret, index)
+		}
+	}
+	return ret
+}
+
+// checkClashes returns ErrorUniqueIndexViolation if one of the records
+// holding a unique value of the record being saved is another record,
+// which isn't one of the ids to ignore
+func (d *model) checkClashes(recs []*store.Record, id interface{}, ignore map[string]bool) error {
+	for _, rec := range recs {
+		clashID, err := d.decodeID(rec.Value)
+		if err != nil {
+			return err
+		}
+		// the clashing record might be the same record being saved again
+		if !reflect.DeepEqual(clashID, id) && !ignore[fmt.Sprint(clashID)] {
+			return ErrorUniqueIndexViolation
+		}
+	}
+	return nil
+}
+
+// save writes the keys of instance in the id index and the given indexes
+// and removes the stale keys of oldEntry, which is nil for new records.
+// Uniqueness is checked for the unique indexes in uniqueChecks.
+func (d *model) save(instance, oldEntry interface{}, indexes, uniqueChecks []Index, options SaveOptions) error {
+	// @todo replace this hack with reflection
+	js, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+
+	id := getFieldValue(instance, d.options.IdIndex.FieldName)
+
+	// Do uniqueness checks before saving any data
+	for _, index := range uniqueChecks {
 		if !index.Unique {
 			continue
 		}
-		potentialClash := reflect.New(reflect.ValueOf(instance).Type()).Interface()
-		err = d.Read(index.ToQuery(getFieldValue(instance, index.FieldName)), &potentialClash)
-		if err != nil && err != ErrorNotFound {
+		q := index.ToQuery(getFieldValue(instance, index.FieldName))
+		// soft deleted records keep their unique values so they can be restored
+		q.IncludeDeleted = true
+		q.Fields = []string{d.options.IdIndex.FieldName}
+		plan, err := d.plan(q)
+		if err != nil {
 			return err
 		}
-
-		if err == nil {
-			return errors.New("Unique index violation")
+		recs, err := d.execute(plan, q)
+		if err != nil {
+			return err
+		}
+		err = d.checkClashes(recs, id, nil)
+		if err != nil {
+			return err
 		}
 	}
 
-	id := getFieldValue(instance, d.options.IdIndex.FieldName)
-	for _, index := range append(d.indexes, d.options.IdIndex) {
+	for _, index := range append(indexes[:len(indexes):len(indexes)], d.options.IdIndex) {
 		// delete non id index keys to prevent stale index values
 		// ie.
 		//
@@ -241,20 +624,24 @@ func (d *model) Save(instance interface{}) error {
 		// types anyway
 		if !indexesMatch(d.options.IdIndex, index) &&
 			oldEntry != nil &&
-			!reflect.DeepEqual(getFieldValue(oldEntry, index.FieldName), getFieldValue(instance, index.FieldName)) {
+			indexChanged(index, oldEntry, instance) {
 			k := d.indexToKey(index, id, oldEntry, true)
-			err = d.store.Delete(k)
+			err = d.storeDelete(index, k)
 			if err != nil {
 				return err
 			}
 		}
 		k := d.indexToKey(index, id, instance, true)
-		if d.options.Debug {
-			fmt.Printf("Saving key '%v', value: '%v'\n", k, string(js))
+		value, err := d.indexValue(index, js)
+		if err != nil {
+			return err
 		}
-		err = d.store.Write(&store.Record{
-			Key:   k,
-			Value: js,
+		// all keys get the same expiry so no index entry
+		// outlives the id index entry
+		err = d.storeWrite(index, &store.Record{
+			Key:    k,
+			Value:  value,
+			Expiry: options.TTL,
 		})
 		if err != nil {
 			return err
@@ -263,76 +650,123 @@ func (d *model) Save(instance interface{}) error {
 	return nil
 }
 
-func getFieldValue(struc interface{}, field string) interface{} {
-	r := reflect.ValueOf(struc)
-	f := reflect.Indirect(r).FieldByName(strings.Title(field))
-
-	if !f.IsValid() {
-		return reflect.Zero(f.Type())
+// indexChanged returns true if the filter or the order field
+// of the index differs between the two entries, ie. the key of
+// the entry in the index changed.
+func indexChanged(i Index, oldEntry, newEntry interface{}) bool {
+	if !reflect.DeepEqual(getFieldValue(oldEntry, i.FieldName), getFieldValue(newEntry, i.FieldName)) {
+		return true
+	}
+	if i.Order.FieldName == "" || i.Order.FieldName == i.FieldName {
+		return false
 	}
-	return f.Interface()
+	return !reflect.DeepEqual(getFieldValue(oldEntry, i.Order.FieldName), getFieldValue(newEntry, i.Order.FieldName))
 }
 
-func setFieldValue(struc interface{}, field string, value interface{}) {
-	r := reflect.ValueOf(struc)
+func getFieldValue(struc interface{}, fieldName string) interface{} {
+	return field(reflect.ValueOf(struc), fieldName).Interface()
+}
 
-	f := reflect.Indirect(r).FieldByName(strings.Title(field))
-	f.Set(reflect.ValueOf(value))
+func setFieldValue(struc interface{}, fieldName string, value interface{}) {
+	f := field(reflect.ValueOf(struc), fieldName)
+	f.Set(toFieldType(reflect.ValueOf(value), f.Type()))
 }
 
-func (d *model) Read(query Query, resultPointer interface{}) error {
-	for _, index := range append(d.indexes, d.options.IdIndex) {
-		if indexMatchesQuery(index, query) {
-			k := d.queryToListKey(index, query)
-			if d.options.Debug {
-				fmt.Printf("Listing key '%v'\n", k)
-			}
-			recs, err := d.store.Read(k, store.ReadPrefix())
-			if err != nil {
-				return err
-			}
-			if len(recs) == 0 {
-				return ErrorNotFound
-			}
-			if len(recs) > 1 {
-				return ErrorMultipleRecordsFound
-			}
-			if d.options.Debug {
-				fmt.Printf("Found value '%v'\n", string(recs[0].Value))
+// toFieldType converts query values to the type of the field they are
+// compared against, so ie. `Equals("id", 1)` works for int64 ids and
+// `Equals("id", "6ba7b810-9dad-11d1-80b4-00c04fd430c8")` works for uuid ids.
+func toFieldType(v reflect.Value, typ reflect.Type) reflect.Value {
+	if v.Type() == typ {
+		return v
+	}
+	if s, ok := v.Interface().(string); ok {
+		ptr := reflect.New(typ)
+		if u, ok := ptr.Interface().(encoding.TextUnmarshaler); ok && typ.Kind() != reflect.String {
+			if err := u.UnmarshalText([]byte(s)); err == nil {
+				return ptr.Elem()
 			}
-			return json.Unmarshal(recs[0].Value, resultPointer)
 		}
 	}
-	return fmt.Errorf("For query type '%v', field '%v' does not match any indexes", query.Type, query.FieldName)
+	// Go converts integers to strings as runes, ie. 5 to "\x05"
+	if typ.Kind() == reflect.String {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return reflect.ValueOf(strconv.FormatInt(v.Int(), 10)).Convert(typ)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return reflect.ValueOf(strconv.FormatUint(v.Uint(), 10)).Convert(typ)
+		}
+	}
+	if v.Type().ConvertibleTo(typ) {
+		return v.Convert(typ)
+	}
+	return v
 }
 
-func (d *model) List(query Query, resultSlicePointer interface{}) error {
-	for _, index := range append(d.indexes, d.options.IdIndex) {
-		if indexMatchesQuery(index, query) {
-			k := d.queryToListKey(index, query)
-			if d.options.Debug {
-				fmt.Printf("Listing key '%v'\n", k)
-			}
-			recs, err := d.store.Read(k, store.ReadPrefix())
-			if err != nil {
-				return err
-			}
-			// @todo speed this up with an actual buffer
-			jsBuffer := []byte("[")
-			for i, rec := range recs {
-				jsBuffer = append(jsBuffer, rec.Value...)
-				if i < len(recs)-1 {
-					jsBuffer = append(jsBuffer, []byte(",")...)
-				}
-			}
-			jsBuffer = append(jsBuffer, []byte("]")...)
-			if d.options.Debug {
-				fmt.Printf("Found values '%v'\n", string(jsBuffer))
-			}
-			return json.Unmarshal(jsBuffer, resultSlicePointer)
+func (d *model) Read(query Query, resultPointer interface{}) (err error) {
+	defer d.observe("read", time.Now(), &err)
+	return d.readOne(query, resultPointer)
+}
+
+func (d *model) readOne(query Query, resultPointer interface{}) error {
+	recs, err := d.read(query)
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return ErrorNotFound
+	}
+	if len(recs) > 1 {
+		return ErrorMultipleRecordsFound
+	}
+	return json.Unmarshal(recs[0].Value, resultPointer)
+}
+
+func (d *model) List(query Query, resultSlicePointer interface{}) (err error) {
+	defer d.observe("list", time.Now(), &err)
+	// List reads all keys at once so the read can be cached
+	it, err := d.iterator(query, 0)
+	if err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(resultSlicePointer).Elem()
+	results := reflect.MakeSlice(slice.Type(), 0, 0)
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		if !it.Next(elem.Interface()) {
+			break
 		}
+		results = reflect.Append(results, elem.Elem())
+	}
+	if it.Err() != nil {
+		return it.Err()
 	}
-	return fmt.Errorf("For query type '%v', field '%v' does not match any indexes", query.Type, query.FieldName)
+	slice.Set(results)
+	return nil
+}
+
+// read returns the raw records from the index matching the query
+func (d *model) read(query Query) ([]*store.Record, error) {
+	plan, err := d.plan(query)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := d.execute(plan, query)
+	if err != nil {
+		return nil, err
+	}
+	return d.finish(recs, query)
+}
+
+// finish hides soft deleted records and projects the
+// records read for a query
+func (d *model) finish(recs []*store.Record, query Query) ([]*store.Record, error) {
+	if d.options.SoftDelete && !query.IncludeDeleted {
+		recs = withoutDeleted(recs)
+	}
+	if len(query.Fields) > 0 {
+		return d.projectRecords(recs, query)
+	}
+	return recs, nil
 }
 
 func indexMatchesQuery(i Index, q Query) bool {
@@ -353,19 +787,107 @@ func indexesMatch(i, j Index) bool {
 	return false
 }
 
+// check returns an error if the context is done
+// or the tenant could not be resolved
+func (d *model) check() error {
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+	return d.tenantErr
+}
+
+// storeRead reads all records with the prefix k, through the cache if one is set up
+func (d *model) storeRead(i Index, k string) ([]*store.Record, error) {
+	return d.storeReadPage(i, k, 0, 0)
+}
+
+// storeReadPage reads a page of the records with the prefix k,
+// zero limit reads all records. Pages are not cached as writes
+// can't tell which pages they invalidate.
+func (d *model) storeReadPage(i Index, k string, limit, offset uint) ([]*store.Record, error) {
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	paged := limit > 0 || offset > 0
+	if d.options.Cache != nil && !paged {
+		if recs, ok := d.options.Cache.get(d.cacheKey(i, k)); ok {
+			d.log("cached read", i, k, map[string]interface{}{"records": len(recs)})
+			return recs, nil
+		}
+	}
+	var generation uint64
+	if d.options.Cache != nil {
+		generation = d.options.Cache.currentGeneration()
+	}
+	start := time.Now()
+	db, table := d.tableOf(i)
+	opts := []store.ReadOption{store.ReadPrefix(), store.ReadFrom(db, table)}
+	if paged {
+		opts = append(opts, store.ReadLimit(limit), store.ReadOffset(offset))
+	}
+	recs, err := d.store.Read(k, opts...)
+	d.observeStoreCall(i, "read", len(recs), start, err)
+	if err != nil {
+		return nil, err
+	}
+	d.log("read", i, k, map[string]interface{}{"records": len(recs)})
+	if d.options.Cache != nil && !paged {
+		d.options.Cache.set(d.cacheKey(i, k), recs, generation)
+	}
+	return recs, nil
+}
+
+func (d *model) storeWrite(i Index, rec *store.Record) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+	if d.logEnabled() {
+		d.log("write", i, rec.Key, map[string]interface{}{
+			"value":    d.redact(rec.Value),
+			"metadata": rec.Metadata,
+			"expiry":   rec.Expiry,
+		})
+	}
+	start := time.Now()
+	db, table := d.tableOf(i)
+	err := d.store.Write(rec, store.WriteTo(db, table))
+	d.observeStoreCall(i, "write", 1, start, err)
+	if d.options.Cache != nil {
+		d.options.Cache.invalidate(d.cacheKey(i, rec.Key))
+	}
+	return err
+}
+
+func (d *model) storeDelete(i Index, k string) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+	d.log("delete", i, k, nil)
+	start := time.Now()
+	db, table := d.tableOf(i)
+	err := d.store.Delete(k, store.DeleteFrom(db, table))
+	d.observeStoreCall(i, "delete", 1, start, err)
+	if d.options.Cache != nil {
+		d.options.Cache.invalidate(d.cacheKey(i, k))
+	}
+	return err
+}
+
+// queryToListKey returns the prefix of the keys matching a query.
+// The prefix ends with a separator, as keys always continue after the
+// queried value, so reading it matches the exact value only and not
+// longer values starting with it, ie. "hello-world" for "hello".
 func (d *model) queryToListKey(i Index, q Query) string {
 	if q.Value == nil {
-		return fmt.Sprintf("%v:%v", d.namespace, indexPrefix(i))
+		return joinKey(d.keyPrefix(i), "")
 	}
 	if i.FieldName != i.Order.FieldName && i.Order.FieldName != "" {
-		return fmt.Sprintf("%v:%v:%v", d.namespace, indexPrefix(i), q.Value)
+		return joinKey(joinKey(d.keyPrefix(i), escapeKey(fmt.Sprint(q.Value))), "")
 	}
 
-	val := reflect.New(reflect.ValueOf(d.instance).Type()).Interface()
-	if q.Value != nil {
-		setFieldValue(val, i.FieldName, q.Value)
-	}
-	return d.indexToKey(i, "", val, false)
+	val := reflect.New(d.typ).Interface()
+	setFieldValue(val, i.FieldName, q.Value)
+	return d.indexToKey(i, "", val, false) + ":"
 }
 
 // appendID true should be used when saving, false when querying
@@ -377,104 +899,271 @@ func (d *model) queryToListKey(i Index, q Query) string {
 // users/30/2
 // without ids we could only have one 30 year old user in the index
 func (d *model) indexToKey(i Index, id interface{}, entry interface{}, appendID bool) string {
-	format := "%v:%v"
-	values := []interface{}{d.namespace, indexPrefix(i)}
-	filterFieldValue := getFieldValue(entry, i.FieldName)
-	orderFieldValue := getFieldValue(entry, i.FieldName)
-	orderFieldKey := i.FieldName
+	v := reflect.Indirect(reflect.ValueOf(entry))
+	enc := keyEncoderOf(v.Type(), i)
+	prefix := d.keyPrefix(i)
+	var b strings.Builder
+	b.WriteString(prefix)
+	// If the filtering field is different than the ordering field,
+	// the filter value comes first
+	if enc.filter != nil {
+		b.WriteByte(':')
+		b.WriteString(escapeKey(enc.encodeFilter(v.FieldByIndex(enc.filter))))
+	}
+	b.WriteByte(':')
+	b.WriteString(enc.encodeOrder(v.FieldByIndex(enc.order)))
+	if appendID {
+		b.WriteByte(':')
+		b.WriteString(escapeKey(idString(id)))
+	}
+	key := b.String()
+	if prefix == "" {
+		// indexes stored in their own table have no prefix
+		key = key[1:]
+	}
+	return key
+}
 
-	if i.FieldName != i.Order.FieldName && i.Order.FieldName != "" {
-		orderFieldValue = getFieldValue(entry, i.Order.FieldName)
-		orderFieldKey = i.Order.FieldName
+// idString formats an id for keys the way fmt.Sprint does
+func idString(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
 	}
+	return fmt.Sprint(id)
+}
 
-	switch i.Type {
-	case indexTypeEq:
-		// If the filtering field is different than the ordering field,
-		// append the filter key to the key.
-		if i.FieldName != i.Order.FieldName && i.Order.FieldName != "" {
-			format += ":%v"
-			values = append(values, filterFieldValue)
+// filterEncoder returns the function formatting filter values of
+// type typ for keys, the way fmt.Sprint does
+func filterEncoder(typ reflect.Type) func(v reflect.Value) string {
+	if typ.Kind() == reflect.Interface || typ.Implements(stringerType) || typ.Implements(errorType) {
+		return func(v reflect.Value) string {
+			return fmt.Sprint(v.Interface())
 		}
 	}
-
-	// Handle the ordering part of the key.
-	// The filter and the ordering field might be the same
-	typ := reflect.TypeOf(orderFieldValue)
-	typName := "nil"
-	if typ != nil {
-		typName = typ.String()
+	switch typ.Kind() {
+	case reflect.String:
+		return reflect.Value.String
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) string {
+			return strconv.FormatInt(v.Int(), 10)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) string {
+			return strconv.FormatUint(v.Uint(), 10)
+		}
+	case reflect.Bool:
+		return func(v reflect.Value) string {
+			return strconv.FormatBool(v.Bool())
+		}
+	}
+	return func(v reflect.Value) string {
+		return fmt.Sprint(v.Interface())
 	}
-	format += ":%v"
+}
 
-	switch v := orderFieldValue.(type) {
-	case string:
+// orderEncoder returns the function encoding the order values of an
+// index, of type typ, so keys sort in the order of the index
+func orderEncoder(i Index, typ reflect.Type) func(v reflect.Value) string {
+	desc := i.Order.Type == OrderTypeDesc
+	switch typ {
+	case stringType:
 		if i.Order.Type != OrderTypeUnordered {
-			values = append(values, d.getOrderedStringFieldKey(i, v))
-			break
+			return func(v reflect.Value) string {
+				return escapeKey(orderedStringKey(i, v.String()))
+			}
 		}
-		values = append(values, v)
-	case int64:
+		return func(v reflect.Value) string {
+			return escapeKey(v.String())
+		}
+	case int64Type:
 		// int64 gets padded to 19 characters as the maximum value of an int64
 		// is 9223372036854775807
 		// @todo handle negative numbers
-		if i.Order.Type == OrderTypeDesc {
-			values = append(values, fmt.Sprintf("%019d", math.MaxInt64-v))
-			break
+		if desc {
+			return func(v reflect.Value) string {
+				return padInt(math.MaxInt64 - v.Int())
+			}
 		}
-		values = append(values, fmt.Sprintf("%019d", v))
-	case float32:
+		return func(v reflect.Value) string {
+			return padInt(v.Int())
+		}
+	case float32Type:
 		// @todo fix display and padding of floats
-		if i.Order.Type == OrderTypeDesc {
-			values = append(values, fmt.Sprintf(i.FloatFormat, i.Float32Max-v))
-			break
+		if desc {
+			return func(v reflect.Value) string {
+				return escapeKey(fmt.Sprintf(i.FloatFormat, i.Float32Max-float32(v.Float())))
+			}
+		}
+		return func(v reflect.Value) string {
+			return escapeKey(fmt.Sprintf(i.FloatFormat, float32(v.Float())))
 		}
-		values = append(values, fmt.Sprintf(i.FloatFormat, v))
-	case float64:
+	case float64Type:
 		// @todo fix display and padding of floats
-		if i.Order.Type == OrderTypeDesc {
-			values = append(values, fmt.Sprintf(i.FloatFormat, i.Float64Max-v))
-			break
+		if desc {
+			return func(v reflect.Value) string {
+				return escapeKey(fmt.Sprintf(i.FloatFormat, i.Float64Max-v.Float()))
+			}
 		}
-		values = append(values, fmt.Sprintf(i.FloatFormat, v))
-	case int:
-		// int gets padded to the same length as int64 to gain
-		// resiliency in case of model type changes.
-		// This could be removed once migrations are implemented
-		// so savings in space for a type reflect in savings in space in the index too.
-		if i.Order.Type == OrderTypeDesc {
-			values = append(values, fmt.Sprintf("%019d", math.MaxInt32-v))
-			break
+		return func(v reflect.Value) string {
+			return escapeKey(fmt.Sprintf(i.FloatFormat, v.Float()))
 		}
-		values = append(values, fmt.Sprintf("%019d", v))
-	case int32:
+	case intType:
 		// int gets padded to the same length as int64 to gain
 		// resiliency in case of model type changes.
 		// This could be removed once migrations are implemented
 		// so savings in space for a type reflect in savings in space in the index too.
-		if i.Order.Type == OrderTypeDesc {
-			values = append(values, fmt.Sprintf("%019d", math.MaxInt32-v))
-			break
+		if desc {
+			return func(v reflect.Value) string {
+				return padInt(int64(math.MaxInt32 - int(v.Int())))
+			}
+		}
+		return func(v reflect.Value) string {
+			return padInt(v.Int())
+		}
+	case int32Type:
+		// int32 gets padded like int, the difference wraps around like int32 does
+		if desc {
+			return func(v reflect.Value) string {
+				return padInt(int64(math.MaxInt32 - int32(v.Int())))
+			}
+		}
+		return func(v reflect.Value) string {
+			return padInt(v.Int())
+		}
+	case boolType:
+		return func(v reflect.Value) string {
+			return strconv.FormatBool(v.Bool() != desc)
+		}
+	}
+	if typ.Implements(textMarshalerType) {
+		// uuids and other types that can represent themselves as text
+		// are indexed as strings.
+		return func(v reflect.Value) string {
+			text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				panic("bug in code, can't marshal " + typ.String() + " for field " + orderField(i.Order, i.FieldName) + ": " + err.Error())
+			}
+			if i.Order.Type != OrderTypeUnordered {
+				return escapeKey(orderedStringKey(i, string(text)))
+			}
+			return escapeKey(string(text))
 		}
-		values = append(values, fmt.Sprintf("%019d", v))
-	case bool:
-		if i.Order.Type == OrderTypeDesc {
-			v = !v
+	}
+	if typ.Kind() == reflect.Interface {
+		// the encoding depends on the value held
+		return func(v reflect.Value) string {
+			if v.IsNil() {
+				panic("bug in code, unhandled type: nil for field " + orderField(i.Order, i.FieldName))
+			}
+			return orderEncoder(i, v.Elem().Type())(v.Elem())
 		}
-		values = append(values, v)
-	default:
-		panic("bug in code, unhandled type: " + typName + " for field " + orderFieldKey)
 	}
+	return func(v reflect.Value) string {
+		panic("bug in code, unhandled type: " + typ.String() + " for field " + orderField(i.Order, i.FieldName))
+	}
+}
 
-	if appendID {
-		format += ":%v"
-		values = append(values, id)
+// padInt zero pads integers to 19 characters like "%019d"
+func padInt(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	width := 19
+	sign := ""
+	if n < 0 {
+		sign, s, width = "-", s[1:], width-1
+	}
+	if len(s) >= width {
+		return sign + s
+	}
+	return sign + strings.Repeat("0", width-len(s)) + s
+}
+
+// keyPrefix returns the first part of the keys of an index.
+// Models stored in their own table don't need the namespace in keys,
+// indexes stored in their own table don't need the index name either.
+func (d *model) keyPrefix(i Index) string {
+	parts := []string{}
+	if len(d.options.Table) == 0 {
+		parts = append(parts, d.namespace)
+	}
+	if d.options.Tenant != nil {
+		parts = append(parts, escapeKey(d.tenant))
+	}
+	if len(d.options.Table) == 0 {
+		parts = append(parts, KeyVersion)
+	}
+	if len(d.options.Table) == 0 || !d.options.TablePerIndex {
+		parts = append(parts, indexPrefix(i))
+	}
+	return strings.Join(parts, ":")
+}
+
+func joinKey(prefix string, value interface{}) string {
+	if len(prefix) == 0 {
+		return fmt.Sprint(value)
+	}
+	return fmt.Sprintf("%v:%v", prefix, value)
+}
+
+// tableOf returns the database and table the keys of an index are stored in.
+// Empty values mean the defaults of the store.
+func (d *model) tableOf(i Index) (string, string) {
+	if len(d.options.Table) == 0 {
+		return d.options.Database, ""
+	}
+	if d.options.TablePerIndex {
+		return d.options.Database, fmt.Sprintf("%v_%v", d.options.Table, indexPrefix(i))
 	}
-	return fmt.Sprintf(format, values...)
+	return d.options.Database, d.options.Table
 }
 
-// indexPrefix returns the first part of the keys, the namespace + index name
+// tables returns all the distinct tables the keys of the model are stored in
+func (d *model) tables() [][2]string {
+	seen := map[[2]string]bool{}
+	ret := [][2]string{}
+	for _, index := range append(d.indexes[:len(d.indexes):len(d.indexes)], d.options.IdIndex) {
+		db, table := d.tableOf(index)
+		t := [2]string{db, table}
+		if !seen[t] {
+			seen[t] = true
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// cacheKey includes the table of the index as keys are not unique across tables
+func (d *model) cacheKey(i Index, k string) string {
+	db, table := d.tableOf(i)
+	return tableCacheKey(db, table, k)
+}
+
+func tableCacheKey(db, table, k string) string {
+	if len(db) == 0 && len(table) == 0 {
+		return k
+	}
+	return fmt.Sprintf("%v/%v/%v", db, table, k)
+}
+
+// Name of the index, used in its keys and table names
+func (i Index) Name() string {
+	return indexPrefix(i)
+}
+
+// indexPrefix returns the index name part of the keys
 func indexPrefix(i Index) string {
+	k := indexKey{i.Type, i.FieldName, i.Order.FieldName, i.Order.Type, strings.Join(i.Projection, ",")}
+	if prefix, ok := indexPrefixes.Load(k); ok {
+		return prefix.(string)
+	}
+	prefix := buildIndexPrefix(i)
+	indexPrefixes.Store(k, prefix)
+	return prefix
+}
+
+func buildIndexPrefix(i Index) string {
 	var ordering string
 	switch i.Order.Type {
 	case OrderTypeUnordered:
@@ -490,36 +1179,53 @@ func indexPrefix(i Index) string {
 		orderingField = i.FieldName
 	}
 	filterField := i.FieldName
-	return fmt.Sprintf("%vBy%v%vBy%v", typ, strings.Title(filterField), ordering, strings.Title(orderingField))
+	prefix := fmt.Sprintf("%vBy%v%vBy%v", typ, strings.Title(filterField), ordering, strings.Title(orderingField))
+	// indexes with a projection store other values than the
+	// same index without one, so their keys can't be shared
+	if len(i.Projection) > 0 {
+		fields := []string{}
+		for _, field := range i.Projection {
+			fields = append(fields, strings.Title(field))
+		}
+		sort.Strings(fields)
+		prefix += "With" + strings.Join(fields, "And")
+	}
+	return prefix
 }
 
 // pad, reverse and optionally base32 encode string keys
-func (d *model) getOrderedStringFieldKey(i Index, fieldValue string) string {
+func orderedStringKey(i Index, fieldValue string) string {
 	runes := []rune{}
 	if i.Order.Type == OrderTypeDesc {
 		for _, char := range fieldValue {
 			runes = append(runes, utf8.MaxRune-char)
 		}
 	} else {
+		// 0 pads ascending values, so 0 and 1 are escaped in a way
+		// that keeps the order and a value never ends in a 0
 		for _, char := range fieldValue {
-			runes = append(runes, char)
+			switch char {
+			case 0:
+				runes = append(runes, 1, 1)
+			case 1:
+				runes = append(runes, 1, 2)
+			default:
+				runes = append(runes, char)
+			}
 		}
 	}
 
-	// padding the string to a fixed length
-	if len(runes) < i.StringOrderPadLength {
+	// padding the string to a fixed length, ascending values are padded
+	// at least once so that "a" sorts before "a!" even above the length
+	if len(runes) < i.StringOrderPadLength || i.Order.Type != OrderTypeDesc {
 		pad := []rune{}
-		for j := 0; j < i.StringOrderPadLength-len(runes); j++ {
+		for j := 0; j < i.StringOrderPadLength-len(runes) || len(pad) == 0; j++ {
 			if i.Order.Type == OrderTypeDesc {
 				pad = append(pad, utf8.MaxRune)
 			} else {
-				// space is the first non control operator char in ASCII
-				// consequently in Utf8 too so we use it as the minimal character here
-				// https://en.wikipedia.org/wiki/ASCII
-				//
-				// Displays somewhat unfortunately
-				// @todo think about a better min rune value to use here.
-				pad = append(pad, rune(32))
+				// 0 is below any escaped char of the value, so
+				// "hello" doesn't share a key with "hello "
+				pad = append(pad, 0)
 			}
 		}
 		runes = append(runes, pad...)
@@ -546,26 +1252,60 @@ func (d *model) getOrderedStringFieldKey(i Index, fieldValue string) string {
 	return keyPart
 }
 
-func (d *model) Delete(query Query) error {
-	if !indexMatchesQuery(d.options.IdIndex, query) {
+func (d *model) Delete(query Query) (err error) {
+	defer d.observe("delete", time.Now(), &err)
+	if d.options.IdIndex.FieldName != query.FieldName ||
+		d.options.IdIndex.Type != query.Type {
 		return errors.New("Delete query does not match default index")
 	}
-	oldEntry := reflect.New(reflect.ValueOf(d.instance).Type()).Interface()
-	err := d.Read(query, &oldEntry)
+	return d.deleteByID(query.Value)
+}
+
+func (d *model) deleteByID(id interface{}) error {
+	oldEntry := reflect.New(d.typ).Interface()
+	rec, err := d.readByID(id, oldEntry)
 	if err != nil {
 		return err
 	}
+	return d.deleteRecord(rec, oldEntry)
+}
 
+// deleteRecord deletes a record read from the id index,
+// decoded into oldEntry
+func (d *model) deleteRecord(rec *store.Record, oldEntry interface{}) error {
+	if isDeleted(rec) {
+		return ErrorNotFound
+	}
+	// hooks get a copy, so changes they make don't
+	// affect the keys being deleted
+	hooked := reflect.New(d.typ)
+	hooked.Elem().Set(reflect.ValueOf(oldEntry).Elem())
+	err := d.beforeDelete(hooked.Interface())
+	if err != nil {
+		return err
+	}
+	if d.options.SoftDelete {
+		err = d.rewrite(oldEntry, rec.Value, map[string]interface{}{
+			deletedMetadataKey: strconv.FormatInt(time.Now().UnixNano(), 10),
+		}, rec.Expiry)
+	} else {
+		err = d.deleteKeys(oldEntry)
+	}
+	if err != nil {
+		return err
+	}
+	d.notify(EventTypeDelete, oldEntry, nil)
+	return d.afterDelete(hooked.Interface())
+}
+
+func (d *model) deleteKeys(oldEntry interface{}) error {
 	// first delete maintained indexes then id index
 	// if we delete id index first then the entry wont
 	// be deletable by id again but the maintained indexes
 	// will be stuck in limbo
-	for _, index := range append(d.indexes, d.options.IdIndex) {
+	for _, index := range append(d.indexes[:len(d.indexes):len(d.indexes)], d.options.IdIndex) {
 		key := d.indexToKey(index, getFieldValue(oldEntry, d.options.IdIndex.FieldName), oldEntry, true)
-		if d.options.Debug {
-			fmt.Printf("Deleting key '%v'\n", key)
-		}
-		err = d.store.Delete(key)
+		err := d.storeDelete(index, key)
 		if err != nil {
 			return err
 		}
@@ -1,13 +1,18 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/store"
 	fs "github.com/micro/micro/v3/service/store/file"
 )
 
@@ -51,6 +56,67 @@ func TestEqualsByID(t *testing.T) {
 	}
 }
 
+func TestExactMatch(t *testing.T) {
+	unordered := ByEquality("tag")
+	unordered.Order.Type = OrderTypeUnordered
+	byCreated := ByEquality("tag")
+	byCreated.Order.FieldName = "created"
+	unique := ByEquality("tag")
+	unique.Unique = true
+	for _, index := range []Index{ByEquality("tag"), unordered, byCreated, unique} {
+		table := New(fs.NewStore(), User{}, Indexes(index), &ModelOptions{
+			Namespace: uuid.Must(uuid.NewV4()).String(),
+		})
+		for _, user := range []User{
+			{ID: "1", Tag: "hello"},
+			{ID: "10", Tag: "hello-world"},
+			{ID: "100", Tag: "hello world"},
+			{ID: "1000", Tag: "hello "},
+		} {
+			err := table.Save(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		user := User{}
+		err := table.Read(Equals("tag", "hello"), &user)
+		if err != nil {
+			t.Fatalf("Index %v: %v", index.Name(), err)
+		}
+		if user.ID != "1" {
+			t.Fatalf("Index %v read %v", index.Name(), user)
+		}
+		err = table.Read(Equals("tag", "hello "), &user)
+		if err != nil {
+			t.Fatalf("Index %v: %v", index.Name(), err)
+		}
+		if user.ID != "1000" {
+			t.Fatalf("Index %v read %v", index.Name(), user)
+		}
+		err = table.Read(Equals("ID", "1"), &user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != "1" {
+			t.Fatal(user)
+		}
+		users := []User{}
+		q := Equals("tag", nil)
+		q.Order = index.Order
+		err = table.List(q, &users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 4 {
+			t.Fatalf("Index %v listed %v", index.Name(), users)
+		}
+		if index.Order.Type == OrderTypeAsc && index.Order.FieldName == "tag" &&
+			(users[0].ID != "1" || users[1].ID != "1000" || users[2].ID != "100") {
+			t.Fatalf("Index %v listed %v", index.Name(), users)
+		}
+	}
+}
+
 func TestRead(t *testing.T) {
 	table := New(fs.NewStore(), User{}, Indexes(ByEquality("age")), &ModelOptions{
 		Namespace: uuid.Must(uuid.NewV4()).String(),
@@ -740,3 +806,728 @@ func getExampleValue(i interface{}, nth int) interface{} {
 	}
 	return nil
 }
+
+type Int64ID struct {
+	ID  int64  `json:"id"`
+	Tag string `json:"tag"`
+}
+
+func TestInt64IDs(t *testing.T) {
+	idIndex := ByEquality("ID")
+	idIndex.Order.Type = OrderTypeDesc
+
+	table := New(fs.NewStore(), Int64ID{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		IdIndex:   idIndex,
+	})
+	for _, id := range []int64{1, 2, 10} {
+		err := table.Save(Int64ID{
+			ID:  id,
+			Tag: "a",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := Int64ID{}
+	err := table.Read(idIndex.ToQuery(2), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != 2 {
+		t.Fatal(res)
+	}
+
+	list := []Int64ID{}
+	err = table.List(idIndex.ToQuery(nil), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].ID != 10 || list[2].ID != 1 {
+		t.Fatal(list)
+	}
+
+	err = table.Delete(Equals("ID", int64(10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.List(Equals("tag", "a"), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatal(list)
+	}
+}
+
+type UUIDID struct {
+	ID  uuid.UUID `json:"id"`
+	Tag string    `json:"tag"`
+}
+
+func TestUUIDIDs(t *testing.T) {
+	table := New(fs.NewStore(), UUIDID{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	id := uuid.Must(uuid.NewV4())
+	err := table.Save(UUIDID{
+		ID:  id,
+		Tag: "a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := UUIDID{}
+	// records with the same id have no order,
+	// so the unordered id index is used
+	err = table.Read(Equals("ID", id.String()), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := Equals("ID", id.String())
+	q.Order.Type = OrderTypeUnordered
+	err = table.Read(q, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != id {
+		t.Fatal(res)
+	}
+
+	err = table.Delete(Equals("ID", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Read(q, &res)
+	if err != ErrorNotFound {
+		t.Fatal(err)
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+	table := New(fs.NewStore(), Int64ID{}, nil, &ModelOptions{
+		Namespace:   uuid.Must(uuid.NewV4()).String(),
+		IdGenerator: AutoIncrement(),
+	})
+	for i := 1; i <= 3; i++ {
+		rec := &Int64ID{Tag: "a"}
+		err := table.Save(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.ID != int64(i) {
+			t.Fatalf("Expected id %v, got %v", i, rec.ID)
+		}
+	}
+
+	// string ids get the sequence in base 10, a taken id isn't overwritten
+	s := fs.NewStore()
+	table = New(s, User{}, nil, &ModelOptions{
+		Namespace:   uuid.Must(uuid.NewV4()).String(),
+		Table:       "users",
+		IdGenerator: AutoIncrement(),
+	})
+	err := table.Save(User{ID: "2", Tag: "taken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Tag: "a"}
+	err = table.Save(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "1" {
+		t.Fatal(user)
+	}
+	err = table.Save(&User{Tag: "b"})
+	if err != ErrorAlreadyExists {
+		t.Fatal(err)
+	}
+	err = table.Read(Equals("ID", 2), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Tag != "taken" {
+		t.Fatal(user)
+	}
+	keys, err := s.List(store.ListFrom("", "users"), store.ListSuffix("sequence"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatal(keys)
+	}
+
+	idIndex := ByEquality("ID")
+	table = New(fs.NewStore(), User{}, nil, &ModelOptions{
+		Namespace:   uuid.Must(uuid.NewV4()).String(),
+		IdIndex:     idIndex,
+		IdGenerator: TimeOrdered(),
+	})
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		user := &User{}
+		err := table.Save(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	users := []User{}
+	err = table.List(idIndex.ToQuery(nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatal(users)
+	}
+	for i, id := range ids {
+		if users[i].ID != id {
+			t.Fatal(ids, users)
+		}
+	}
+}
+
+type pathMask []string
+
+func (p pathMask) GetPaths() []string {
+	return p
+}
+
+func TestPatch(t *testing.T) {
+	tagIndex := ByEquality("tag")
+	tagIndex.Unique = true
+	table := New(fs.NewStore(), User{}, Indexes(tagIndex, ByEquality("age")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	err := table.Save(User{
+		ID:  "1",
+		Age: 12,
+		Tag: "hi-there",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Save(User{
+		ID:  "2",
+		Age: 13,
+		Tag: "taken",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idQuery := Equals("ID", "1")
+	err = table.Patch(idQuery, map[string]interface{}{
+		"tag": "hello-there",
+		// json numbers decode to float64
+		"age": float64(20),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []User{}
+	err = table.List(Equals("tag", "hi-there"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Fatal(users)
+	}
+	err = table.List(Equals("age", 20), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Tag != "hello-there" {
+		t.Fatal(users)
+	}
+
+	err = table.Patch(idQuery, map[string]interface{}{"tag": "taken"})
+	if err == nil {
+		t.Fatal("Patch should fail because the tag index is unique")
+	}
+
+	fields, err := MaskedFields(User{HasPet: true, Tag: "ignored"}, pathMask{"hasPet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Patch(idQuery, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.List(Equals("tag", "hello-there"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || !users[0].HasPet || users[0].Age != 20 {
+		t.Fatal(users)
+	}
+}
+
+func TestPatchWrites(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	namespace := uuid.Must(uuid.NewV4()).String()
+	ageIndex := ByEquality("age")
+	ageIndex.Projection = []string{"tag"}
+	table := New(fs.NewStore(), User{}, Indexes(ageIndex), &ModelOptions{
+		Namespace: namespace,
+		Metrics:   metrics,
+		Hooks: Hooks{
+			BeforeSave: []Hook{func(ctx context.Context, record interface{}) error {
+				if record.(*User).Tag == "change-id" {
+					record.(*User).ID = "2"
+				}
+				return nil
+			}},
+		},
+	})
+	err := table.Save(User{ID: "1", Age: 12, Tag: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writes := func() uint64 {
+		return metrics.StoreCall(namespace, ageIndex.Name(), "write").Count
+	}
+	if writes() != 1 {
+		t.Fatal(writes())
+	}
+
+	// the projection doesn't store hasPet
+	err = table.Patch(Equals("ID", "1"), map[string]interface{}{"hasPet": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writes() != 1 {
+		t.Fatalf("Unchanged index written %v times", writes())
+	}
+	err = table.Patch(Equals("ID", "1"), map[string]interface{}{"tag": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writes() != 2 {
+		t.Fatalf("Changed index written %v times", writes())
+	}
+	users := []User{}
+	q := Equals("age", 12)
+	q.Fields = []string{"id", "tag"}
+	err = table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Tag != "b" {
+		t.Fatal(users)
+	}
+
+	err = table.Patch(Equals("ID", "1"), map[string]interface{}{"tag": "change-id"})
+	if err == nil {
+		t.Fatal("Hooks should not be able to change the id")
+	}
+}
+
+func TestCreateUpdate(t *testing.T) {
+	tagIndex := ByEquality("tag")
+	tagIndex.Unique = true
+	table := New(fs.NewStore(), User{}, Indexes(tagIndex), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	err := table.Update(User{
+		ID:  "1",
+		Tag: "hi-there",
+	})
+	if err != ErrorNotFound {
+		t.Fatal(err)
+	}
+	err = table.Create(User{
+		ID:  "1",
+		Tag: "hi-there",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Create(User{
+		ID:  "1",
+		Tag: "hello-there",
+	})
+	if err != ErrorAlreadyExists {
+		t.Fatal(err)
+	}
+	// saving the same unique value again must not clash with itself
+	err = table.Update(User{
+		ID:  "1",
+		Age: 20,
+		Tag: "hi-there",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Create(User{
+		ID:  "2",
+		Tag: "hi-there",
+	})
+	if err != ErrorUniqueIndexViolation {
+		t.Fatal(err)
+	}
+
+	user := User{}
+	err = table.Read(Equals("tag", "hi-there"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Age != 20 {
+		t.Fatal(user)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		TTL:       time.Hour,
+	})
+	err := table.Save(User{
+		ID:  "1",
+		Tag: "session",
+	}, WithTTL(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Save(User{
+		ID:  "2",
+		Tag: "session",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	users := []User{}
+	err = table.List(Equals("tag", "session"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != "2" {
+		t.Fatal(users)
+	}
+	idQuery := Equals("ID", "1")
+	idQuery.Order.Type = OrderTypeUnordered
+	err = table.Read(idQuery, &User{})
+	if err != ErrorNotFound {
+		t.Fatal(err)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	tagIndex := ByEquality("tag")
+	tagIndex.Unique = true
+	table := New(fs.NewStore(), User{}, Indexes(tagIndex), &ModelOptions{
+		Namespace:  uuid.Must(uuid.NewV4()).String(),
+		SoftDelete: true,
+	})
+	for _, id := range []string{"1", "2"} {
+		err := table.Save(User{
+			ID:  id,
+			Tag: "tag-" + id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	idQuery := Equals("ID", "1")
+	idQuery.Order.Type = OrderTypeUnordered
+	err := table.Delete(idQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Read(idQuery, &User{})
+	if err != ErrorNotFound {
+		t.Fatal(err)
+	}
+	users := []User{}
+	err = table.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != "2" {
+		t.Fatal(users)
+	}
+	q := Equals("tag", nil)
+	q.IncludeDeleted = true
+	err = table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatal(users)
+	}
+	// deleted records keep their unique values until purged
+	err = table.Save(User{
+		ID:  "3",
+		Tag: "tag-1",
+	})
+	if err != ErrorUniqueIndexViolation {
+		t.Fatal(err)
+	}
+
+	err = table.Restore(idQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Read(Equals("tag", "tag-1"), &User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = table.Delete(idQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Purge(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletedQuery := idQuery
+	deletedQuery.IncludeDeleted = true
+	err = table.Read(deletedQuery, &User{})
+	if err != nil {
+		t.Fatal("Record deleted recently should not be purged", err)
+	}
+	err = table.Purge(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != "2" {
+		t.Fatal(users)
+	}
+}
+
+type HookedTag struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+func (h *HookedTag) BeforeSave(ctx context.Context) error {
+	if h.Slug == "" {
+		h.Slug = strings.ToLower(strings.ReplaceAll(h.Title, " ", "-"))
+	}
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	slugIndex := ByEquality("slug")
+	slugIndex.Order.Type = OrderTypeUnordered
+
+	deleted := []string{}
+	table := New(fs.NewStore(), HookedTag{}, nil, &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		IdIndex:   slugIndex,
+		Hooks: Hooks{
+			BeforeSave: []Hook{func(ctx context.Context, record interface{}) error {
+				if record.(*HookedTag).Title == "" {
+					return errors.New("title is required")
+				}
+				return nil
+			}},
+			AfterDelete: []Hook{func(ctx context.Context, record interface{}) error {
+				deleted = append(deleted, record.(*HookedTag).Slug)
+				return nil
+			}},
+		},
+	})
+	err := table.Save(HookedTag{})
+	if err == nil {
+		t.Fatal("Save should be aborted by the before save hook")
+	}
+	err = table.Save(HookedTag{Title: "Hello World"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := HookedTag{}
+	err = table.Read(slugIndex.ToQuery("hello-world"), &tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Delete(slugIndex.ToQuery("hello-world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != "hello-world" {
+		t.Fatal(deleted)
+	}
+}
+
+func TestDeleteHookChanges(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Hooks: Hooks{
+			BeforeDelete: []Hook{func(ctx context.Context, record interface{}) error {
+				record.(*User).Tag = "changed"
+				return nil
+			}},
+		},
+	})
+	err := table.Save(User{ID: "1", Tag: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Delete(Equals("ID", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []User{}
+	err = table.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("Stale index keys left: %v", users)
+	}
+}
+
+type testPublisher struct {
+	topics []string
+	events []Event
+	err    error
+}
+
+func (p *testPublisher) Publish(topic string, msg interface{}, opts ...events.PublishOption) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.topics = append(p.topics, topic)
+	p.events = append(p.events, msg.(Event))
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	pub := &testPublisher{}
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Stream:    pub,
+		Topic:     "users",
+	})
+	w, err := table.Watch(Equals("tag", "go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	err = table.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Save(User{ID: "2", Tag: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Save(User{ID: "1", Tag: "go", Age: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idQuery := Equals("ID", "1")
+	idQuery.Order.Type = OrderTypeUnordered
+	err = table.Delete(idQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EventType{EventTypeCreate, EventTypeUpdate, EventTypeDelete}
+	for _, typ := range expected {
+		select {
+		case ev := <-w.Chan():
+			if ev.Type != typ || ev.Record.(*User).ID != "1" {
+				t.Fatalf("Expected %v event, got %v", typ, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for", typ)
+		}
+	}
+	select {
+	case ev := <-w.Chan():
+		t.Fatal("Unexpected event", ev)
+	default:
+	}
+
+	if len(pub.events) != 4 || pub.topics[0] != "users" {
+		t.Fatal(pub.events)
+	}
+	if pub.events[2].Old.(*User).Age != 0 {
+		t.Fatal(pub.events[2])
+	}
+}
+
+func TestWatchCopy(t *testing.T) {
+	table := New(fs.NewStore(), User{}, nil, &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	w, err := table.Watch(Equals("ID", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	user := &User{ID: "1", Tag: "go"}
+	err = table.Save(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the caller can keep changing the record it saved
+	user.Tag = "rust"
+	ev := <-w.Chan()
+	if ev.Record == user || ev.Record.(*User).Tag != "go" {
+		t.Fatal(ev)
+	}
+}
+
+func TestWatchOverflow(t *testing.T) {
+	table := New(fs.NewStore(), User{}, nil, &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	w, err := table.Watch(Equals("ID", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing reads the events, saves must not block
+	for i := 0; i <= WatchBufferSize; i++ {
+		err = table.Save(User{ID: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := 0
+	for range w.Chan() {
+		received++
+	}
+	if received != WatchBufferSize {
+		t.Fatalf("Expected %v events before the watcher got stopped, got %v", WatchBufferSize, received)
+	}
+}
+
+func TestPublishFailure(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	namespace := uuid.Must(uuid.NewV4()).String()
+	saved := 0
+	table := New(fs.NewStore(), User{}, nil, &ModelOptions{
+		Namespace: namespace,
+		Stream:    &testPublisher{err: errors.New("stream unavailable")},
+		Metrics:   metrics,
+		Hooks: Hooks{
+			AfterSave: []Hook{func(ctx context.Context, record interface{}) error {
+				saved++
+				return nil
+			}},
+		},
+	})
+	// the record is stored, so the save succeeds
+	err := table.Save(User{ID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 1 {
+		t.Fatal("After save hooks should run")
+	}
+	if metrics.Operation(namespace, "publish").Errors != 1 {
+		t.Fatal(metrics.Operation(namespace, "publish"))
+	}
+}
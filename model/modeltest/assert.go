@@ -0,0 +1,48 @@
+package modeltest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/micro/dev/model"
+)
+
+// IndexKeys returns the keys of an index of a model stored in the default
+// table of the store, namespace being the namespace of the model
+// including the tenant if the model has one, ie. "users:tenant-1"
+func IndexKeys(s *Store, namespace string, index model.Index) []string {
+	return s.Keys("", "", fmt.Sprintf("%v:%v:%v:", namespace, model.KeyVersion, index.Name()))
+}
+
+// AssertIndex fails the test if the index doesn't hold count keys
+func AssertIndex(t testing.TB, s *Store, namespace string, index model.Index, count int) {
+	t.Helper()
+	keys := IndexKeys(s, namespace, index)
+	if len(keys) != count {
+		t.Fatalf("Expected %v keys in index %v, got %v: %v", count, index.Name(), len(keys), keys)
+	}
+}
+
+// AssertConsistent fails the test unless all indexes hold the same number
+// of keys, which they do unless a save or delete failed partway through.
+// Pass the id index of the model too, ie. the default one:
+//
+//	idIndex := model.ByEquality("ID")
+//	idIndex.Order.Type = model.OrderTypeUnordered
+func AssertConsistent(t testing.TB, s *Store, namespace string, indexes ...model.Index) {
+	t.Helper()
+	counts := map[string]int{}
+	first := -1
+	consistent := true
+	for _, index := range indexes {
+		n := len(IndexKeys(s, namespace, index))
+		counts[index.Name()] = n
+		if first >= 0 && n != first {
+			consistent = false
+		}
+		first = n
+	}
+	if !consistent {
+		t.Fatalf("Indexes hold different numbers of keys: %v", counts)
+	}
+}
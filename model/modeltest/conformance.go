@@ -0,0 +1,196 @@
+package modeltest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/dev/model"
+	"github.com/micro/micro/v3/service/store"
+)
+
+// Conformance runs the behaviours models rely on against stores created
+// by newStore, each guarantee in its own subtest so failures show which
+// ones a store violates:
+//
+//	func TestMyStore(t *testing.T) {
+//		modeltest.Conformance(t, func() store.Store {
+//			return mystore.NewStore()
+//		})
+//	}
+func Conformance(t *testing.T, newStore func() store.Store) {
+	t.Run("PrefixReads", func(t *testing.T) {
+		testPrefixReads(t, newStore())
+	})
+	t.Run("Ordering", func(t *testing.T) {
+		testOrdering(t, newStore())
+	})
+	t.Run("StaleIndexRemoval", func(t *testing.T) {
+		testStaleIndexRemoval(t, newStore())
+	})
+	t.Run("Uniqueness", func(t *testing.T) {
+		testUniqueness(t, newStore())
+	})
+	t.Run("Pagination", func(t *testing.T) {
+		testPagination(t, newStore())
+	})
+}
+
+// namespace returns a namespace unique to the run, as
+// stores like the file store keep keys between runs
+func namespace(name string) string {
+	return name + "-" + uuid.Must(uuid.NewV4()).String()
+}
+
+type conformanceRecord struct {
+	ID      string `json:"id"`
+	Tag     string `json:"tag"`
+	Created int64  `json:"created"`
+}
+
+// testPrefixReads checks prefix reads return only keys with the
+// prefix, sorted, whatever order they were written in
+func testPrefixReads(t *testing.T, s store.Store) {
+	ns := namespace("prefix")
+	for _, k := range []string{":b", ":c", ":a", "", "x:a"} {
+		err := s.Write(&store.Record{Key: ns + k, Value: []byte(k)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := s.Read(ns+":", store.ReadPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, rec := range recs {
+		keys = append(keys, string(rec.Value))
+	}
+	if fmt.Sprint(keys) != "[:a :b :c]" {
+		t.Fatalf("Prefix read returned %v", keys)
+	}
+}
+
+// testOrdering checks records are listed in the order of ascending
+// and descending indexes, which relies on keys being read in byte order
+func testOrdering(t *testing.T, s store.Store) {
+	desc := model.ByEquality("created")
+	desc.Order.Type = model.OrderTypeDesc
+	for _, index := range []model.Index{model.ByEquality("created"), desc, model.ByEquality("tag")} {
+		m := model.New(s, conformanceRecord{}, model.Indexes(index), &model.ModelOptions{
+			Namespace: namespace("ordering"),
+		})
+		for i, tag := range []string{"b", "c", "a", "aa"} {
+			err := m.Save(conformanceRecord{ID: fmt.Sprint(i), Tag: tag, Created: int64([]int{20, 3, 100, 1}[i])})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		results := []conformanceRecord{}
+		q := model.Equals(index.FieldName, nil)
+		q.Order.Type = index.Order.Type
+		err := m.List(q, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		want := map[string]string{
+			model.ByEquality("created").Name(): "[3 1 0 2]",
+			desc.Name():                        "[2 0 1 3]",
+			model.ByEquality("tag").Name():     "[2 3 0 1]",
+		}[index.Name()]
+		if fmt.Sprint(ids) != want {
+			t.Errorf("Index %v listed %v, expected %v", index.Name(), ids, want)
+		}
+	}
+}
+
+// testStaleIndexRemoval checks updates remove the keys of old values
+func testStaleIndexRemoval(t *testing.T, s store.Store) {
+	m := model.New(s, conformanceRecord{}, model.Indexes(model.ByEquality("tag")), &model.ModelOptions{
+		Namespace: namespace("stale"),
+	})
+	err := m.Save(conformanceRecord{ID: "1", Tag: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Save(conformanceRecord{ID: "1", Tag: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []conformanceRecord{}
+	err = m.List(model.Equals("tag", "old"), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("Stale index key found: %v", results)
+	}
+	err = m.List(model.Equals("tag", nil), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Tag != "new" {
+		t.Fatal(results)
+	}
+}
+
+// testUniqueness checks unique indexes reject duplicates
+// but not saving the same record again
+func testUniqueness(t *testing.T, s store.Store) {
+	tag := model.ByEquality("tag")
+	tag.Unique = true
+	m := model.New(s, conformanceRecord{}, model.Indexes(tag), &model.ModelOptions{
+		Namespace: namespace("unique"),
+	})
+	err := m.Save(conformanceRecord{ID: "1", Tag: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Save(conformanceRecord{ID: "1", Tag: "a", Created: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Save(conformanceRecord{ID: "2", Tag: "a"})
+	if err != model.ErrorUniqueIndexViolation {
+		t.Fatalf("Expected unique index violation, got %v", err)
+	}
+}
+
+// testPagination checks prefix reads honour limits and offsets
+// and iterating pages returns every record once
+func testPagination(t *testing.T, s store.Store) {
+	ns := namespace("pagination")
+	m := model.New(s, conformanceRecord{}, model.Indexes(model.ByEquality("created")), &model.ModelOptions{
+		Namespace: ns,
+		PageSize:  3,
+	})
+	for i := 0; i < 10; i++ {
+		err := m.Save(conformanceRecord{ID: fmt.Sprint(i), Created: int64(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := s.Read(ns+":", store.ReadPrefix(), store.ReadLimit(2), store.ReadOffset(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("Expected 2 records read with a limit, got %v", len(recs))
+	}
+
+	ids := []string{}
+	err = m.Iterate(model.Equals("created", nil), func(record interface{}) error {
+		ids = append(ids, record.(*conformanceRecord).ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Fatalf("Iterating pages returned %v", ids)
+	}
+}
@@ -0,0 +1,20 @@
+package modeltest
+
+import (
+	"testing"
+
+	"github.com/micro/micro/v3/service/store"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestConformance(t *testing.T) {
+	Conformance(t, func() store.Store {
+		return NewStore()
+	})
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	Conformance(t, func() store.Store {
+		return fs.NewStore()
+	})
+}
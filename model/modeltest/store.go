@@ -0,0 +1,306 @@
+// Package modeltest provides an in-memory store with fault injection
+// and assertions on index contents, for testing code built on models.
+package modeltest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// Calls a fault can be injected into
+const (
+	CallRead   = "read"
+	CallWrite  = "write"
+	CallDelete = "delete"
+	CallList   = "list"
+)
+
+// Fault changes the outcome of matching store calls
+type Fault struct {
+	// Call the fault applies to, ie. CallWrite, all calls if empty
+	Call string
+	// KeyPrefix of the keys the fault applies to, all keys if empty.
+	// Lists only match faults without a key prefix.
+	KeyPrefix string
+	// Nth makes only the nth matching call fail, counting from 1.
+	// Every matching call fails if zero.
+	Nth int
+	// Err is returned by matching calls, which leave the store unchanged
+	Err error
+	// Delay matching calls
+	Delay time.Duration
+	// Drop makes matching writes and deletes report success
+	// without changing the store
+	Drop bool
+
+	// matched counts the calls matching the fault
+	matched int
+}
+
+// Store is an in-memory store.Store. Reads and lists with
+// a prefix return keys in order, like the file store.
+type Store struct {
+	sync.Mutex
+	options store.Options
+	tables  map[string]map[string]*entry
+	faults  []*Fault
+	calls   map[string]int
+}
+
+type entry struct {
+	record  *store.Record
+	expires time.Time
+}
+
+// NewStore returns an empty in-memory store
+func NewStore(opts ...store.Option) *Store {
+	s := &Store{
+		tables: map[string]map[string]*entry{},
+		calls:  map[string]int{},
+	}
+	for _, o := range opts {
+		o(&s.options)
+	}
+	return s
+}
+
+// Inject adds a fault, faults are checked in the order they were added
+func (s *Store) Inject(f Fault) {
+	s.Lock()
+	defer s.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Reset removes all faults
+func (s *Store) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.faults = nil
+}
+
+// Calls returns the number of calls made, ie. Calls(CallWrite)
+func (s *Store) Calls(call string) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.calls[call]
+}
+
+// Keys returns the sorted keys with a prefix in a table,
+// empty database and table mean the defaults of the store
+func (s *Store) Keys(database, table, prefix string) []string {
+	s.Lock()
+	defer s.Unlock()
+	return s.keys(s.table(database, table), prefix)
+}
+
+// fault counts the call and returns the first fault matching it
+func (s *Store) fault(call, key string) *Fault {
+	s.calls[call]++
+	for _, f := range s.faults {
+		if len(f.Call) > 0 && f.Call != call {
+			continue
+		}
+		if len(f.KeyPrefix) > 0 && (call == CallList || !strings.HasPrefix(key, f.KeyPrefix)) {
+			continue
+		}
+		f.matched++
+		if f.Nth > 0 && f.matched != f.Nth {
+			continue
+		}
+		return f
+	}
+	return nil
+}
+
+// apply delays the call and returns the error of a fault.
+// The lock is released during the delay.
+func (s *Store) apply(f *Fault) error {
+	if f == nil {
+		return nil
+	}
+	if f.Delay > 0 {
+		s.Unlock()
+		time.Sleep(f.Delay)
+		s.Lock()
+	}
+	return f.Err
+}
+
+func (s *Store) table(database, table string) map[string]*entry {
+	if len(database) == 0 {
+		database = s.options.Database
+	}
+	if len(table) == 0 {
+		table = s.options.Table
+	}
+	k := database + "/" + table
+	if s.tables[k] == nil {
+		s.tables[k] = map[string]*entry{}
+	}
+	return s.tables[k]
+}
+
+// keys returns the sorted keys with a prefix, removing expired keys
+func (s *Store) keys(t map[string]*entry, prefix string) []string {
+	keys := []string{}
+	for k, e := range t {
+		if e.expired() {
+			delete(t, k)
+			continue
+		}
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *entry) expired() bool {
+	return !e.expires.IsZero() && time.Now().After(e.expires)
+}
+
+func page(keys []string, limit, offset uint) []string {
+	if offset >= uint(len(keys)) {
+		return []string{}
+	}
+	keys = keys[offset:]
+	if limit > 0 && limit < uint(len(keys)) {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+func (s *Store) Init(opts ...store.Option) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, o := range opts {
+		o(&s.options)
+	}
+	return nil
+}
+
+func (s *Store) Options() store.Options {
+	s.Lock()
+	defer s.Unlock()
+	return s.options
+}
+
+func (s *Store) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	options := store.ReadOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if err := s.apply(s.fault(CallRead, key)); err != nil {
+		return nil, err
+	}
+	t := s.table(options.Database, options.Table)
+	if !options.Prefix {
+		e, ok := t[key]
+		if !ok || e.expired() {
+			return nil, store.ErrNotFound
+		}
+		return []*store.Record{copyRecord(e)}, nil
+	}
+	recs := []*store.Record{}
+	for _, k := range page(s.keys(t, key), options.Limit, options.Offset) {
+		recs = append(recs, copyRecord(t[k]))
+	}
+	return recs, nil
+}
+
+func (s *Store) Write(r *store.Record, opts ...store.WriteOption) error {
+	options := store.WriteOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+	s.Lock()
+	defer s.Unlock()
+	f := s.fault(CallWrite, r.Key)
+	if err := s.apply(f); err != nil || (f != nil && f.Drop) {
+		return err
+	}
+	e := &entry{
+		record: &store.Record{
+			Key:      r.Key,
+			Value:    append([]byte{}, r.Value...),
+			Metadata: map[string]interface{}{},
+		},
+	}
+	for k, v := range r.Metadata {
+		e.record.Metadata[k] = v
+	}
+	switch {
+	case !options.Expiry.IsZero():
+		e.expires = options.Expiry
+	case options.TTL > 0:
+		e.expires = time.Now().Add(options.TTL)
+	case r.Expiry > 0:
+		e.expires = time.Now().Add(r.Expiry)
+	}
+	s.table(options.Database, options.Table)[r.Key] = e
+	return nil
+}
+
+func (s *Store) Delete(key string, opts ...store.DeleteOption) error {
+	options := store.DeleteOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+	s.Lock()
+	defer s.Unlock()
+	f := s.fault(CallDelete, key)
+	if err := s.apply(f); err != nil || (f != nil && f.Drop) {
+		return err
+	}
+	delete(s.table(options.Database, options.Table), key)
+	return nil
+}
+
+func (s *Store) List(opts ...store.ListOption) ([]string, error) {
+	options := store.ListOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if err := s.apply(s.fault(CallList, "")); err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, k := range s.keys(s.table(options.Database, options.Table), options.Prefix) {
+		if strings.HasSuffix(k, options.Suffix) {
+			keys = append(keys, k)
+		}
+	}
+	return page(keys, options.Limit, options.Offset), nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) String() string {
+	return "modeltest"
+}
+
+// copyRecord returns a copy of a stored record with the remaining time
+// to live as expiry, so callers can't modify the stored record
+func copyRecord(e *entry) *store.Record {
+	r := *e.record
+	r.Value = append([]byte{}, e.record.Value...)
+	r.Metadata = map[string]interface{}{}
+	for k, v := range e.record.Metadata {
+		r.Metadata[k] = v
+	}
+	if !e.expires.IsZero() {
+		r.Expiry = time.Until(e.expires)
+	}
+	return &r
+}
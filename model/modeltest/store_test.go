@@ -0,0 +1,192 @@
+package modeltest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/micro/dev/model"
+	"github.com/micro/micro/v3/service/store"
+)
+
+type User struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag"`
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	for _, k := range []string{"b", "a:2", "a:1"} {
+		err := s.Write(&store.Record{Key: k, Value: []byte(k)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := s.Read("a", store.ReadPrefix(), store.ReadLimit(1), store.ReadOffset(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Key != "a:2" {
+		t.Fatal(recs)
+	}
+	_, err = s.Read("a")
+	if err != store.ErrNotFound {
+		t.Fatal(err)
+	}
+
+	err = s.Write(&store.Record{Key: "c", Expiry: time.Millisecond}, store.WriteTo("db", "t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.Keys("db", "t", ""); len(keys) != 1 {
+		t.Fatal(keys)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if keys := s.Keys("db", "t", ""); len(keys) != 0 {
+		t.Fatal(keys)
+	}
+	if s.Calls(CallWrite) != 4 || s.Calls(CallRead) != 2 {
+		t.Fatal(s.Calls(CallWrite), s.Calls(CallRead))
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := NewStore()
+	failed := errors.New("failed")
+	s.Inject(Fault{Call: CallWrite, KeyPrefix: "a", Nth: 2, Err: failed})
+	s.Inject(Fault{Call: CallDelete, Drop: true})
+	for i, want := range []error{nil, failed, nil} {
+		err := s.Write(&store.Record{Key: "a"})
+		if err != want {
+			t.Fatalf("Write %v: expected %v, got %v", i, want, err)
+		}
+	}
+	err := s.Delete("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.Keys("", "", "a"); len(keys) != 1 {
+		t.Fatal("Delete should have been dropped")
+	}
+	s.Reset()
+	err = s.Delete("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.Keys("", "", "a"); len(keys) != 0 {
+		t.Fatal(keys)
+	}
+}
+
+func TestPartialSave(t *testing.T) {
+	s := NewStore()
+	tag := model.ByEquality("tag")
+	idIndex := model.ByEquality("ID")
+	idIndex.Order.Type = model.OrderTypeUnordered
+	users := model.New(s, User{}, model.Indexes(tag), &model.ModelOptions{
+		Namespace: "users",
+	})
+	err := users.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertIndex(t, s, "users", tag, 1)
+	AssertConsistent(t, s, "users", idIndex, tag)
+
+	// the id index is written after the tag index
+	failed := errors.New("failed")
+	s.Inject(Fault{Call: CallWrite, KeyPrefix: "users:" + model.KeyVersion + ":" + idIndex.Name(), Err: failed})
+	err = users.Save(User{ID: "2", Tag: "rust"})
+	if err != failed {
+		t.Fatal(err)
+	}
+	if len(IndexKeys(s, "users", tag)) != 2 || len(IndexKeys(s, "users", idIndex)) != 1 {
+		t.Fatal("Save should have failed partway through")
+	}
+
+	// saving again repairs the indexes
+	s.Reset()
+	err = users.Save(User{ID: "2", Tag: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertConsistent(t, s, "users", idIndex, tag)
+}
+
+func TestBatchRoundTrips(t *testing.T) {
+	s := NewStore()
+	tag := model.ByEquality("tag")
+	tag.Unique = true
+	users := model.New(s, User{}, model.Indexes(tag), &model.ModelOptions{
+		Namespace: "users",
+	})
+	batch := []User{}
+	ids := []interface{}{}
+	for i := 0; i < 50; i++ {
+		batch = append(batch, User{ID: fmt.Sprint(i), Tag: fmt.Sprint("tag-", i)})
+		ids = append(ids, fmt.Sprint(i))
+	}
+	// saving again reads the stored records instead of an empty index
+	for i := 0; i < 2; i++ {
+		reads, writes := s.Calls(CallRead), s.Calls(CallWrite)
+		err := users.SaveMany(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// one read for the id index and one for the unique index
+		if r := s.Calls(CallRead) - reads; r != 2 {
+			t.Fatalf("Expected 2 reads, got %v", r)
+		}
+		if w := s.Calls(CallWrite) - writes; w != 100 {
+			t.Fatalf("Expected a write per key, got %v", w)
+		}
+	}
+
+	reads := s.Calls(CallRead)
+	results := []User{}
+	err := users.ReadMany(ids, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Calls(CallRead) - reads; r != 1 {
+		t.Fatalf("Expected 1 read, got %v", r)
+	}
+	if len(results) != 50 || results[49].Tag != "tag-49" {
+		t.Fatal(results)
+	}
+
+	// sparse ids never take more reads than reading them one by one
+	more := []User{}
+	for i := 50; i < 300; i++ {
+		more = append(more, User{ID: fmt.Sprint(i), Tag: fmt.Sprint("tag-", i)})
+	}
+	err = users.SaveMany(more)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads = s.Calls(CallRead)
+	err = users.ReadMany([]interface{}{"0", "299", "missing"}, &results)
+	if _, ok := err.(*model.BatchError); !ok {
+		t.Fatal(err)
+	}
+	if r := s.Calls(CallRead) - reads; r > 4 {
+		t.Fatalf("Expected at most 4 reads, got %v", r)
+	}
+	if results[0].Tag != "tag-0" || results[1].Tag != "tag-299" {
+		t.Fatal(results)
+	}
+
+	reads, deletes := s.Calls(CallRead), s.Calls(CallDelete)
+	err = users.DeleteMany(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pages of the 300 ids instead of a read per id
+	if r := s.Calls(CallRead) - reads; r > 4 {
+		t.Fatalf("Expected at most 4 reads, got %v", r)
+	}
+	if d := s.Calls(CallDelete) - deletes; d != 100 {
+		t.Fatalf("Expected a delete per key, got %v", d)
+	}
+}
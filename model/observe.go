@@ -0,0 +1,216 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/micro/v3/service/context/metadata"
+	"github.com/micro/micro/v3/service/logger"
+)
+
+// DefaultLogMetadata are the context metadata keys
+// added to log fields by default
+var DefaultLogMetadata = []string{"Micro-Namespace", "Micro-Trace-Id"}
+
+// Metrics gets notified of model operations and store round trips.
+// Implementations can forward them to ie. prometheus.
+type Metrics interface {
+	// ObserveOperation is called after every model operation,
+	// ie. "save", "read", "list" or "delete".
+	ObserveOperation(model, operation string, took time.Duration, err error)
+	// ObserveStoreCall is called after every store round trip. Call is
+	// "read", "write" or "delete", keys is the number of keys read,
+	// written or deleted and index is the name of the index the keys belong to.
+	ObserveStoreCall(model, index, call string, keys int, took time.Duration, err error)
+}
+
+// LatencyBuckets are the upper bounds of the latency
+// histogram buckets used by MemoryMetrics
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+type Histogram struct {
+	Count  uint64
+	Errors uint64
+	// Keys read, written or deleted, only set for store calls
+	Keys uint64
+	Sum  time.Duration
+	// Buckets holds the counts for each of the LatencyBuckets,
+	// plus one for the ones above the largest bucket.
+	Buckets []uint64
+}
+
+func (h *Histogram) observe(took time.Duration, keys int, err error) {
+	if h.Buckets == nil {
+		h.Buckets = make([]uint64, len(LatencyBuckets)+1)
+	}
+	h.Count++
+	h.Keys += uint64(keys)
+	h.Sum += took
+	if err != nil {
+		h.Errors++
+	}
+	for i, bound := range LatencyBuckets {
+		if took <= bound {
+			h.Buckets[i]++
+			return
+		}
+	}
+	h.Buckets[len(LatencyBuckets)]++
+}
+
+func (h *Histogram) copy() Histogram {
+	cp := *h
+	cp.Buckets = append([]uint64{}, h.Buckets...)
+	return cp
+}
+
+// MemoryMetrics keeps metrics in memory, mostly useful for tests and debugging.
+type MemoryMetrics struct {
+	sync.Mutex
+	operations map[string]*Histogram
+	storeCalls map[string]*Histogram
+}
+
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		operations: map[string]*Histogram{},
+		storeCalls: map[string]*Histogram{},
+	}
+}
+
+func (m *MemoryMetrics) ObserveOperation(model, operation string, took time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	k := fmt.Sprintf("%v/%v", model, operation)
+	if m.operations[k] == nil {
+		m.operations[k] = &Histogram{}
+	}
+	m.operations[k].observe(took, 0, err)
+}
+
+func (m *MemoryMetrics) ObserveStoreCall(model, index, call string, keys int, took time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	k := fmt.Sprintf("%v/%v/%v", model, index, call)
+	if m.storeCalls[k] == nil {
+		m.storeCalls[k] = &Histogram{}
+	}
+	m.storeCalls[k].observe(took, keys, err)
+}
+
+// Operation returns the histogram of an operation of a model
+func (m *MemoryMetrics) Operation(model, operation string) Histogram {
+	m.Lock()
+	defer m.Unlock()
+	h, ok := m.operations[fmt.Sprintf("%v/%v", model, operation)]
+	if !ok {
+		return Histogram{}
+	}
+	return h.copy()
+}
+
+// StoreCall returns the histogram of a store call made for an index of a model
+func (m *MemoryMetrics) StoreCall(model, index, call string) Histogram {
+	m.Lock()
+	defer m.Unlock()
+	h, ok := m.storeCalls[fmt.Sprintf("%v/%v/%v", model, index, call)]
+	if !ok {
+		return Histogram{}
+	}
+	return h.copy()
+}
+
+// observe reports a model operation, use it deferred with a named error:
+//
+//	defer d.observe("save", time.Now(), &err)
+func (d *model) observe(operation string, start time.Time, err *error) {
+	if d.options.Metrics != nil {
+		d.options.Metrics.ObserveOperation(d.namespace, operation, time.Since(start), *err)
+	}
+}
+
+func (d *model) observeStoreCall(i Index, call string, keys int, start time.Time, err error) {
+	if d.options.Metrics != nil {
+		d.options.Metrics.ObserveStoreCall(d.namespace, indexPrefix(i), call, keys, time.Since(start), err)
+	}
+}
+
+func (d *model) logLevel() logger.Level {
+	if d.options.LogLevel != nil {
+		return *d.options.LogLevel
+	}
+	if d.options.Debug {
+		return logger.InfoLevel
+	}
+	return logger.DebugLevel
+}
+
+func (d *model) logger() logger.Logger {
+	if d.options.Logger != nil {
+		return d.options.Logger
+	}
+	return logger.DefaultLogger
+}
+
+func (d *model) logEnabled() bool {
+	return logger.V(d.logLevel(), d.logger())
+}
+
+// log logs a store call with the model, the index and the key as fields.
+// The part of the key after the index prefix holds field values,
+// so it is redacted like values are.
+func (d *model) log(call string, i Index, key string, fields map[string]interface{}) {
+	if !d.logEnabled() {
+		return
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	key = d.redactKey(i, key)
+	fields["model"] = d.namespace
+	fields["index"] = indexPrefix(i)
+	fields["key"] = key
+	keys := d.options.LogMetadata
+	if keys == nil {
+		keys = DefaultLogMetadata
+	}
+	for _, k := range keys {
+		if v, ok := metadata.Get(d.ctx, k); ok {
+			fields[k] = v
+		}
+	}
+	d.logger().Fields(fields).Logf(d.logLevel(), "Store %v '%v'", call, key)
+}
+
+// redactKey returns the loggable form of a key of an index
+func (d *model) redactKey(i Index, key string) string {
+	prefix := d.keyPrefix(i)
+	if len(prefix) > 0 {
+		prefix += ":"
+	}
+	if !strings.HasPrefix(key, prefix) {
+		prefix = ""
+	}
+	if len(key) == len(prefix) {
+		return key
+	}
+	return prefix + d.redact([]byte(key[len(prefix):]))
+}
+
+// redact returns the loggable form of a value
+func (d *model) redact(value []byte) string {
+	if d.options.RedactValue != nil {
+		return d.options.RedactValue(value)
+	}
+	return fmt.Sprintf("<redacted %v bytes>", len(value))
+}
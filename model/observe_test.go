@@ -0,0 +1,127 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/logger"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+type testLogger struct {
+	logger.Logger
+	fields   []map[string]interface{}
+	levels   []logger.Level
+	messages []string
+}
+
+func (l *testLogger) Options() logger.Options {
+	return logger.Options{Level: logger.DebugLevel}
+}
+
+func (l *testLogger) Fields(fields map[string]interface{}) logger.Logger {
+	l.fields = append(l.fields, fields)
+	return l
+}
+
+func (l *testLogger) Logf(level logger.Level, format string, v ...interface{}) {
+	l.levels = append(l.levels, level)
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func TestLoggingRedactsValues(t *testing.T) {
+	l := &testLogger{}
+	tagIndex := ByEquality("tag")
+	tagIndex.Unique = true
+	table := New(fs.NewStore(), User{}, Indexes(tagIndex), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Logger:    l,
+	})
+	err := table.Save(User{ID: "1", Tag: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys of the unique index hold the value too
+	for i, fields := range l.fields {
+		if strings.Contains(fmt.Sprint(fields["key"]), "secret") || strings.Contains(l.messages[i], "secret") {
+			t.Fatal("Keys should be redacted", fields, l.messages[i])
+		}
+	}
+	written := 0
+	for _, fields := range l.fields {
+		value, ok := fields["value"]
+		if !ok {
+			continue
+		}
+		written++
+		if strings.Contains(value.(string), "secret") {
+			t.Fatal("Values should be redacted", value)
+		}
+	}
+	if written != 2 {
+		t.Fatal(l.fields)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	for _, level := range []logger.Level{logger.TraceLevel, logger.InfoLevel, logger.WarnLevel} {
+		l := &testLogger{}
+		table := New(fs.NewStore(), User{}, nil, &ModelOptions{
+			Namespace: uuid.Must(uuid.NewV4()).String(),
+			Logger:    l,
+			LogLevel:  &level,
+		})
+		err := table.Save(User{ID: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the logger only logs debug level and above
+		if level == logger.TraceLevel && len(l.levels) != 0 {
+			t.Fatal(l.levels)
+		}
+		if level != logger.TraceLevel && (len(l.levels) == 0 || l.levels[0] != level) {
+			t.Fatal(l.levels)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	namespace := uuid.Must(uuid.NewV4()).String()
+	tagIndex := ByEquality("tag")
+	table := New(fs.NewStore(), User{}, Indexes(tagIndex), &ModelOptions{
+		Namespace: namespace,
+		Metrics:   metrics,
+	})
+	for _, id := range []string{"1", "2"} {
+		err := table.Save(User{ID: id, Tag: "go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	users := []User{}
+	err := table.List(Equals("tag", "go"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := metrics.Operation(namespace, "save"); h.Count != 2 || h.Errors != 0 {
+		t.Fatal(h)
+	}
+	if h := metrics.StoreCall(namespace, indexPrefix(tagIndex), "write"); h.Keys != 2 {
+		t.Fatal(h)
+	}
+	h := metrics.StoreCall(namespace, indexPrefix(tagIndex), "read")
+	if h.Count != 1 || h.Keys != 2 {
+		t.Fatal(h)
+	}
+	total := uint64(0)
+	for _, c := range h.Buckets {
+		total += c
+	}
+	if total != h.Count {
+		t.Fatal(h)
+	}
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FieldMask is implemented by protobuf field masks
+// (google.golang.org/protobuf/types/known/fieldmaskpb.FieldMask).
+type FieldMask interface {
+	GetPaths() []string
+}
+
+// MaskedFields returns the values of the fields listed in the mask
+// from instance, in a format that is accepted by Patch.
+// Paths can either be field names or json names, nested paths are
+// not supported.
+func MaskedFields(instance interface{}, mask FieldMask) (map[string]interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(instance))
+	fields := map[string]interface{}{}
+	for _, path := range mask.GetPaths() {
+		if strings.Contains(path, ".") {
+			return nil, fmt.Errorf("Nested field mask path '%v' is not supported", path)
+		}
+		fieldName, err := structFieldName(v.Type(), path)
+		if err != nil {
+			return nil, err
+		}
+		fields[fieldName] = v.FieldByName(fieldName).Interface()
+	}
+	return fields, nil
+}
+
+func (d *model) Patch(query Query, fields map[string]interface{}, opts ...SaveOption) (err error) {
+	defer d.observe("patch", time.Now(), &err)
+	if d.options.IdIndex.FieldName != query.FieldName ||
+		d.options.IdIndex.Type != query.Type {
+		return errors.New("Patch query does not match default index")
+	}
+	typ := d.typ
+	idFieldName, err := structFieldName(typ, d.options.IdIndex.FieldName)
+	if err != nil {
+		return err
+	}
+
+	recs, err := d.read(d.options.IdIndex.ToQuery(query.Value))
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return ErrorNotFound
+	}
+	if len(recs) > 1 {
+		return ErrorMultipleRecordsFound
+	}
+	oldEntry := reflect.New(typ).Interface()
+	err = json.Unmarshal(recs[0].Value, oldEntry)
+	if err != nil {
+		return err
+	}
+	// keep the remaining time to live of the record
+	options := SaveOptions{
+		TTL: recs[0].Expiry,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	// the old entry is kept intact so stale index keys can be removed
+	newEntry := reflect.New(typ)
+	newEntry.Elem().Set(reflect.ValueOf(oldEntry).Elem())
+
+	for name, value := range fields {
+		fieldName, err := structFieldName(typ, name)
+		if err != nil {
+			return err
+		}
+		if fieldName == idFieldName {
+			return errors.New("Patch can't change the id of a record")
+		}
+		f := newEntry.Elem().FieldByName(fieldName)
+		if value == nil {
+			f.Set(reflect.Zero(f.Type()))
+		} else {
+			v := toFieldType(reflect.ValueOf(value), f.Type())
+			if !v.Type().AssignableTo(f.Type()) {
+				return fmt.Errorf("Can't set field '%v' of type %v to a value of type %v", name, f.Type(), v.Type())
+			}
+			f.Set(v)
+		}
+	}
+
+	err = d.beforeSave(newEntry.Interface())
+	if err != nil {
+		return err
+	}
+	// hooks can modify the record too
+	if !reflect.DeepEqual(getFieldValue(newEntry.Interface(), idFieldName), getFieldValue(oldEntry, idFieldName)) {
+		return errors.New("Patch can't change the id of a record")
+	}
+
+	// only indexes with changed keys need uniqueness checks
+	uniqueChecks := d.uniqueChecks(newEntry.Interface(), oldEntry)
+	// a new TTL has to be applied to every key
+	writes := d.indexes
+	if options.TTL == recs[0].Expiry {
+		writes, err = d.changedIndexes(oldEntry, newEntry.Interface())
+		if err != nil {
+			return err
+		}
+	}
+	err = d.save(newEntry.Interface(), oldEntry, writes, uniqueChecks, options)
+	if err != nil {
+		return err
+	}
+	d.notify(EventTypeUpdate, newEntry.Interface(), oldEntry)
+	return d.afterSave(newEntry.Interface())
+}
+
+// changedIndexes returns the indexes with a different key or stored value
+// for the two entries. Indexes without a projection store a full copy of
+// the record so they change with every field, indexes with a projection
+// only change with the fields they store.
+func (d *model) changedIndexes(oldEntry, newEntry interface{}) ([]Index, error) {
+	oldJs, err := json.Marshal(oldEntry)
+	if err != nil {
+		return nil, err
+	}
+	newJs, err := json.Marshal(newEntry)
+	if err != nil {
+		return nil, err
+	}
+	changed := []Index{}
+	for _, index := range d.indexes {
+		if indexChanged(index, oldEntry, newEntry) {
+			changed = append(changed, index)
+			continue
+		}
+		oldValue, err := d.indexValue(index, oldJs)
+		if err != nil {
+			return nil, err
+		}
+		newValue, err := d.indexValue(index, newJs)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(oldValue, newValue) {
+			changed = append(changed, index)
+		}
+	}
+	return changed, nil
+}
+
+// structFieldName finds the name of a struct field either by the
+// titled name (the same way indexes look up fields), case insensitively
+// or by its json name.
+func structFieldName(typ reflect.Type, name string) (string, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if f, ok := typ.FieldByName(strings.Title(name)); ok {
+		return f.Name, nil
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if strings.EqualFold(f.Name, name) || jsonName == name {
+			return f.Name, nil
+		}
+	}
+	return "", fmt.Errorf("Field '%v' not found in %v", name, typ)
+}
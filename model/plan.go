@@ -0,0 +1,508 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// Plan describes how a query is executed, see Explain
+type Plan struct {
+	// Index the keys are read from
+	Index Index
+	// Scan is true when no index matches the query, so all records of
+	// Index are read and filtered in process. See Query.AllowFiltering.
+	Scan bool
+	// Sort is true when the records of a scan are sorted in process
+	// because Index is not ordered by the order of the query.
+	Sort bool
+	// Ranges of keys read from the store
+	Ranges []KeyRange
+	// Plans of the queries of an And or Or query, their
+	// results are intersected or, with Union set, joined
+	Plans []*Plan
+	Union bool
+	// Merge is true when the keys of Plans are all ordered by the same
+	// field encoded the same way, so the results are intersected by
+	// merging them in order. Each plan is read in pages of PageSize,
+	// and reading stops at the end of any of them.
+	Merge bool
+}
+
+// KeyRange is a prefix of keys read from a table of the store
+type KeyRange struct {
+	Database string
+	Table    string
+	Prefix   string
+}
+
+func (p Plan) String() string {
+	if len(p.Plans) > 0 {
+		plans := []string{}
+		for _, sub := range p.Plans {
+			plans = append(plans, sub.String())
+		}
+		how := "intersect"
+		if p.Merge {
+			how = "merge"
+		}
+		if p.Union {
+			how = "union"
+		}
+		s := fmt.Sprintf("%v (%v)", how, strings.Join(plans, "; "))
+		if p.Sort {
+			s += ", sort in process"
+		}
+		return s
+	}
+	ranges := []string{}
+	for _, r := range p.Ranges {
+		ranges = append(ranges, r.String())
+	}
+	how := "read"
+	if p.Scan {
+		how = "scan and filter"
+	}
+	s := fmt.Sprintf("%v %v %v", how, indexPrefix(p.Index), strings.Join(ranges, ", "))
+	if p.Sort {
+		s += ", sort in process"
+	}
+	return s
+}
+
+func (r KeyRange) String() string {
+	if len(r.Database) == 0 && len(r.Table) == 0 {
+		return fmt.Sprintf("prefix '%v'", r.Prefix)
+	}
+	return fmt.Sprintf("prefix '%v' in %v/%v", r.Prefix, r.Database, r.Table)
+}
+
+func (d *model) Explain(query Query) (*Plan, error) {
+	if d.tenantErr != nil {
+		return nil, d.tenantErr
+	}
+	return d.plan(query)
+}
+
+// plan picks the index to read a query from. In order of preference:
+//
+//   - an index matching the filter field, type and order of the query,
+//     preferring the ones ordered by the order field of the query
+//   - for queries with a value and ordered by the filter field, any index
+//     on the filter field, as records with the same value have no order.
+//     Indexes with an extra order field can be used this way.
+//   - a scan of an index ordered like the query, or of the id index,
+//     if the query allows filtering
+func (d *model) plan(query Query) (*Plan, error) {
+	switch query.Type {
+	case queryTypeAnd:
+		return d.andPlan(query)
+	case queryTypeOr:
+		return d.orPlan(query)
+	}
+	indexes := append(d.indexes[:len(d.indexes):len(d.indexes)], d.options.IdIndex)
+	if len(query.Fields) > 0 {
+		// indexes with a projection store less, so they are read first
+		indexes = append([]Index{}, indexes...)
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return len(indexes[i].Projection) > 0 && len(indexes[j].Projection) == 0
+		})
+	}
+	for _, index := range indexes {
+		if indexMatchesQuery(index, query) && d.covers(index, query) &&
+			orderField(index.Order, index.FieldName) == orderField(query.Order, query.FieldName) {
+			return d.indexPlan(index, query), nil
+		}
+	}
+	for _, index := range indexes {
+		if indexMatchesQuery(index, query) && d.covers(index, query) {
+			return d.indexPlan(index, query), nil
+		}
+	}
+	if query.Value != nil && orderField(query.Order, query.FieldName) == query.FieldName {
+		for _, index := range indexes {
+			if index.FieldName == query.FieldName && index.Type == query.Type && d.covers(index, query) {
+				return d.indexPlan(index, query), nil
+			}
+		}
+	}
+	if !query.AllowFiltering {
+		for _, index := range indexes {
+			if len(index.Projection) > 0 && index.FieldName == query.FieldName && index.Type == query.Type {
+				return nil, fmt.Errorf("For query type '%v', field '%v' only matches indexes with a projection, select fields stored in them or add an index without one", query.Type, query.FieldName)
+			}
+		}
+		return nil, fmt.Errorf("For query type '%v', field '%v' does not match any indexes", query.Type, query.FieldName)
+	}
+
+	plan := &Plan{
+		Index: d.options.IdIndex,
+		Scan:  true,
+		Sort:  query.Order.Type != OrderTypeUnordered,
+	}
+	for _, index := range indexes {
+		// an index listing all records in the order of the query
+		// scans need all fields to filter the records
+		if len(index.Projection) == 0 &&
+			orderField(index.Order, index.FieldName) == index.FieldName &&
+			index.FieldName == orderField(query.Order, query.FieldName) &&
+			index.Order.Type == query.Order.Type {
+			plan.Index = index
+			plan.Sort = false
+			break
+		}
+	}
+	db, table := d.tableOf(plan.Index)
+	plan.Ranges = []KeyRange{{
+		Database: db,
+		Table:    table,
+		Prefix:   d.queryToListKey(plan.Index, Query{}),
+	}}
+	return plan, nil
+}
+
+// andPlan plans each query of an And query. Results get merged when
+// all of them are read from indexes ordered by the same extra order field,
+// as keys of each index then only differ in their filter value prefix.
+func (d *model) andPlan(query Query) (*Plan, error) {
+	if len(query.Queries) == 0 {
+		return nil, errors.New("And query needs at least one query")
+	}
+	plan := &Plan{
+		Merge: true,
+	}
+	for _, q := range query.Queries {
+		if query.AllowFiltering {
+			q.AllowFiltering = true
+		}
+		if len(query.Fields) > 0 {
+			q.Fields = query.Fields
+		}
+		sub, err := d.plan(q)
+		if err != nil {
+			return nil, err
+		}
+		plan.Plans = append(plan.Plans, sub)
+	}
+	first := plan.Plans[0].Index
+	for i, sub := range plan.Plans {
+		if sub.Scan || len(sub.Plans) > 0 || len(sub.Ranges) != 1 ||
+			query.Queries[i].Value == nil ||
+			orderField(sub.Index.Order, sub.Index.FieldName) == sub.Index.FieldName ||
+			orderField(sub.Index.Order, sub.Index.FieldName) != orderField(first.Order, first.FieldName) ||
+			sub.Index.Order.Type != first.Order.Type ||
+			!orderEncodingMatches(sub.Index, first) {
+			plan.Merge = false
+		}
+	}
+	return plan, nil
+}
+
+// orderEncodingMatches returns true if the indexes encode the
+// values of their order fields the same way in keys
+func orderEncodingMatches(i, j Index) bool {
+	return i.StringOrderPadLength == j.StringOrderPadLength &&
+		i.Base32Encode == j.Base32Encode &&
+		i.FloatFormat == j.FloatFormat &&
+		i.Float32Max == j.Float32Max &&
+		i.Float64Max == j.Float64Max
+}
+
+// orPlan plans each query of an Or query. Results of several
+// queries are sorted in process unless the query is unordered.
+func (d *model) orPlan(query Query) (*Plan, error) {
+	if len(query.Queries) == 0 {
+		return nil, errors.New("Or query needs at least one query")
+	}
+	plan := &Plan{
+		Union: true,
+		Sort:  len(query.Queries) > 1 && query.Order.Type != OrderTypeUnordered,
+	}
+	for _, q := range query.Queries {
+		if query.AllowFiltering {
+			q.AllowFiltering = true
+		}
+		if len(query.Fields) > 0 {
+			// results are sorted by the order field
+			q.Fields = append([]string{orderField(query.Order, query.FieldName)}, query.Fields...)
+		}
+		sub, err := d.plan(q)
+		if err != nil {
+			return nil, err
+		}
+		plan.Plans = append(plan.Plans, sub)
+	}
+	return plan, nil
+}
+
+func (d *model) indexPlan(index Index, query Query) *Plan {
+	db, table := d.tableOf(index)
+	return &Plan{
+		Index: index,
+		Ranges: []KeyRange{{
+			Database: db,
+			Table:    table,
+			Prefix:   d.queryToListKey(index, query),
+		}},
+	}
+}
+
+// orderField returns the field the order is on,
+// which defaults to the filter field
+func orderField(o Order, fieldName string) string {
+	if len(o.FieldName) == 0 {
+		return fieldName
+	}
+	return o.FieldName
+}
+
+// execute reads the records of a plan
+func (d *model) execute(plan *Plan, query Query) ([]*store.Record, error) {
+	if plan.Union {
+		return d.union(plan, query)
+	}
+	if len(plan.Plans) > 0 {
+		return d.intersect(plan, query)
+	}
+	recs := []*store.Record{}
+	for _, r := range plan.Ranges {
+		rs, err := d.storeRead(plan.Index, r.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rs...)
+	}
+	if !plan.Scan {
+		return recs, nil
+	}
+	return d.filter(recs, query, plan.Sort)
+}
+
+// intersect returns the records found by all plans of an And query
+func (d *model) intersect(plan *Plan, query Query) ([]*store.Record, error) {
+	if plan.Merge {
+		return d.mergeIntersect(plan.Plans)
+	}
+	results := [][]*store.Record{}
+	for i, sub := range plan.Plans {
+		recs, err := d.execute(sub, query.Queries[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(recs) == 0 {
+			return recs, nil
+		}
+		results = append(results, recs)
+	}
+
+	// keep the records of the first query found by all the others
+	ids := make([]map[string]bool, len(results))
+	for i, recs := range results[1:] {
+		ids[i+1] = map[string]bool{}
+		for _, rec := range recs {
+			id, err := d.recordID(rec)
+			if err != nil {
+				return nil, err
+			}
+			ids[i+1][id] = true
+		}
+	}
+	ret := []*store.Record{}
+	for _, rec := range results[0] {
+		id, err := d.recordID(rec)
+		if err != nil {
+			return nil, err
+		}
+		found := true
+		for _, set := range ids[1:] {
+			if !set[id] {
+				found = false
+				break
+			}
+		}
+		if found {
+			ret = append(ret, rec)
+		}
+	}
+	return ret, nil
+}
+
+// union returns the records found by any plan of an Or query, each once
+func (d *model) union(plan *Plan, query Query) ([]*store.Record, error) {
+	seen := map[string]bool{}
+	ret := []*store.Record{}
+	keys := map[*store.Record]string{}
+	for i, sub := range plan.Plans {
+		recs, err := d.execute(sub, query.Queries[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			entry, err := d.decode(rec)
+			if err != nil {
+				return nil, err
+			}
+			id := fmt.Sprint(getFieldValue(entry, d.options.IdIndex.FieldName))
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			ret = append(ret, rec)
+			if plan.Sort {
+				keys[rec] = d.orderKey(query, entry)
+			}
+		}
+	}
+	if plan.Sort {
+		sort.SliceStable(ret, func(i, j int) bool {
+			return keys[ret[i]] < keys[ret[j]]
+		})
+	}
+	return ret, nil
+}
+
+// mergeIntersect intersects the records of plans reading a single range
+// each, sorted by the part of their keys after the prefix read, which is
+// the order value and the id. Each range is read page by page, advancing
+// the ones behind.
+func (d *model) mergeIntersect(plans []*Plan) ([]*store.Record, error) {
+	cursors := make([]*pageCursor, len(plans))
+	for i, plan := range plans {
+		cursors[i] = &pageCursor{d: d, index: plan.Index, prefix: plan.Ranges[0].Prefix}
+	}
+	ret := []*store.Record{}
+	for {
+		max := ""
+		for _, c := range cursors {
+			rec, err := c.head()
+			if err != nil {
+				return nil, err
+			}
+			if rec == nil {
+				return ret, nil
+			}
+			if s := c.suffix(rec); s > max {
+				max = s
+			}
+		}
+		all := true
+		for _, c := range cursors {
+			rec, _ := c.head()
+			if c.suffix(rec) < max {
+				c.pos++
+				all = false
+			}
+		}
+		if all {
+			rec, _ := cursors[0].head()
+			ret = append(ret, rec)
+			for _, c := range cursors {
+				c.pos++
+			}
+		}
+	}
+}
+
+// pageCursor walks the records with a prefix a page at a time
+type pageCursor struct {
+	d      *model
+	index  Index
+	prefix string
+	page   []*store.Record
+	pos    int
+	offset uint
+	done   bool
+}
+
+// head returns the current record, reading the next page
+// when needed, or nil when all records were walked
+func (c *pageCursor) head() (*store.Record, error) {
+	if c.pos < len(c.page) {
+		return c.page[c.pos], nil
+	}
+	if c.done {
+		return nil, nil
+	}
+	pageSize := c.d.pageSize()
+	recs, err := c.d.storeReadPage(c.index, c.prefix, pageSize, c.offset)
+	if err != nil {
+		return nil, err
+	}
+	c.offset += uint(len(recs))
+	c.page, c.pos = recs, 0
+	c.done = uint(len(recs)) < pageSize
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	return recs[0], nil
+}
+
+func (c *pageCursor) suffix(rec *store.Record) string {
+	return strings.TrimPrefix(rec.Key, c.prefix)
+}
+
+// decode unmarshals a record read from the store
+func (d *model) decode(rec *store.Record) (interface{}, error) {
+	entry := reflect.New(d.typ).Interface()
+	return entry, json.Unmarshal(rec.Value, entry)
+}
+
+// recordID returns the id of a record read from the store
+func (d *model) recordID(rec *store.Record) (string, error) {
+	id, err := d.decodeID(rec.Value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(id), nil
+}
+
+// orderKey returns a key of the entry sorting
+// in the order of the query, ties broken by id
+func (d *model) orderKey(query Query, entry interface{}) string {
+	orderIndex := ByEquality(orderField(query.Order, query.FieldName))
+	orderIndex.Order.Type = query.Order.Type
+	return d.indexToKey(orderIndex, getFieldValue(entry, d.options.IdIndex.FieldName), entry, true)
+}
+
+// filter keeps the records matching the query and sorts them
+// by the order of the query if needed
+func (d *model) filter(recs []*store.Record, query Query, sortRecs bool) ([]*store.Record, error) {
+	fieldName, err := structFieldName(d.typ, query.FieldName)
+	if err != nil {
+		return nil, err
+	}
+	matching := []*store.Record{}
+	keys := map[*store.Record]string{}
+	for _, rec := range recs {
+		entry, err := d.decode(rec)
+		if err != nil {
+			return nil, err
+		}
+		if query.Value != nil && !fieldEquals(entry, fieldName, query.Value) {
+			continue
+		}
+		matching = append(matching, rec)
+		if sortRecs {
+			keys[rec] = d.orderKey(query, entry)
+		}
+	}
+	if sortRecs {
+		sort.SliceStable(matching, func(i, j int) bool {
+			return keys[matching[i]] < keys[matching[j]]
+		})
+	}
+	return matching, nil
+}
+
+// fieldEquals compares a field of a record to a query value,
+// converting the value to the type of the field
+func fieldEquals(record interface{}, fieldName string, value interface{}) bool {
+	field := reflect.Indirect(reflect.ValueOf(record)).FieldByName(fieldName)
+	v := toFieldType(reflect.ValueOf(value), field.Type())
+	return reflect.DeepEqual(field.Interface(), v.Interface())
+}
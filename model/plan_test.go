@@ -0,0 +1,312 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestPlan(t *testing.T) {
+	byTagByCreated := ByEquality("tag")
+	byTagByCreated.Order.FieldName = "created"
+	byTagByCreated.Order.Type = OrderTypeDesc
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("age"), byTagByCreated), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	for i, tag := range []string{"go", "rust", "go"} {
+		err := table.Save(User{ID: string(rune('1' + i)), Tag: tag, Age: 30 - i, Created: int64(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the index ordered by created can be used as the
+	// query has a value and no specific order
+	plan, err := table.Explain(Equals("tag", "go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Scan || indexPrefix(plan.Index) != indexPrefix(byTagByCreated) {
+		t.Fatal(plan)
+	}
+	users := []User{}
+	err = table.List(Equals("tag", "go"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != "3" {
+		t.Fatal(users)
+	}
+
+	q := Equals("hasPet", false)
+	_, err = table.Explain(q)
+	if err == nil {
+		t.Fatal("Query without index should fail")
+	}
+	q.AllowFiltering = true
+	plan, err = table.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Scan || !plan.Sort || !strings.Contains(plan.String(), "scan") {
+		t.Fatal(plan)
+	}
+	err = table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatal(users)
+	}
+
+	// scans an index in the order of the query, without sorting
+	q = Equals("hasPet", false)
+	q.Order = Order{FieldName: "age", Type: OrderTypeAsc}
+	q.AllowFiltering = true
+	plan, err = table.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Scan || plan.Sort || plan.Index.FieldName != "age" {
+		t.Fatal(plan)
+	}
+	err = table.List(q, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[0].ID != "3" || users[2].ID != "1" {
+		t.Fatal(users)
+	}
+}
+
+func TestPlanIndexesCapacity(t *testing.T) {
+	// spare capacity must not be written to, concurrent queries share it
+	indexes := make([]Index, 1, 2)
+	indexes[0] = ByEquality("tag")
+	table := New(fs.NewStore(), User{}, indexes, &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	err := table.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []User{}
+	err = table.List(Equals("ID", "1"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || indexes[:2][1].FieldName != "" {
+		t.Fatal(users, indexes[:2])
+	}
+}
+
+func TestAnd(t *testing.T) {
+	byCreated := func(field string) Index {
+		i := ByEquality(field)
+		i.Order.FieldName = "created"
+		i.Order.Type = OrderTypeDesc
+		return i
+	}
+	for _, indexes := range [][]Index{
+		Indexes(ByEquality("tag"), ByEquality("age")),
+		Indexes(byCreated("tag"), byCreated("age")),
+	} {
+		table := New(fs.NewStore(), User{}, indexes, &ModelOptions{
+			Namespace: uuid.Must(uuid.NewV4()).String(),
+		})
+		users := []User{
+			{ID: "1", Tag: "go", Age: 30, Created: 1},
+			{ID: "2", Tag: "go", Age: 31, Created: 2},
+			{ID: "3", Tag: "rust", Age: 30, Created: 3},
+			{ID: "4", Tag: "go", Age: 30, Created: 4},
+		}
+		for _, user := range users {
+			err := table.Save(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		q := And(Equals("tag", "go"), Equals("age", 30))
+		plan, err := table.Explain(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		merge := indexes[0].Order.FieldName == "created"
+		if len(plan.Plans) != 2 || plan.Merge != merge {
+			t.Fatal(plan)
+		}
+		results := []User{}
+		err = table.List(q, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 {
+			t.Fatal(results)
+		}
+		// ordered by the index of the first query
+		if merge && (results[0].ID != "4" || results[1].ID != "1") {
+			t.Fatal(results)
+		}
+		if !merge && (results[0].ID != "1" || results[1].ID != "4") {
+			t.Fatal(results)
+		}
+
+		err = table.List(And(Equals("tag", "rust"), Equals("age", 31)), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 0 {
+			t.Fatal(results)
+		}
+	}
+}
+
+func TestAndMergePages(t *testing.T) {
+	byCreated := func(field string) Index {
+		i := ByEquality(field)
+		i.Order.FieldName = "created"
+		i.Order.Type = OrderTypeDesc
+		return i
+	}
+	metrics := NewMemoryMetrics()
+	namespace := uuid.Must(uuid.NewV4()).String()
+	table := New(fs.NewStore(), User{}, Indexes(byCreated("tag"), byCreated("age")), &ModelOptions{
+		Namespace: namespace,
+		PageSize:  2,
+		Metrics:   metrics,
+	})
+	for i := 1; i <= 6; i++ {
+		age := 31
+		if i%3 != 2 {
+			age = 30
+		}
+		if i == 6 {
+			age = 32
+		}
+		err := table.Save(User{ID: fmt.Sprint(i), Tag: "go", Age: age, Created: int64(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagReads := func() uint64 {
+		return metrics.StoreCall(namespace, indexPrefix(byCreated("tag")), "read").Count
+	}
+
+	// matches spread over the pages of both indexes
+	results := []User{}
+	err := table.List(And(Equals("tag", "go"), Equals("age", 30)), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, user := range results {
+		ids = append(ids, user.ID)
+	}
+	if strings.Join(ids, ",") != "4,3,1" {
+		t.Fatal(ids)
+	}
+
+	// the only record of age 32 is on the first page of tags,
+	// so the other pages are not read
+	before := tagReads()
+	err = table.List(And(Equals("tag", "go"), Equals("age", 32)), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "6" {
+		t.Fatal(results)
+	}
+	if tagReads()-before != 1 {
+		t.Fatalf("Expected 1 read of tags, got %v", tagReads()-before)
+	}
+}
+
+func TestAndOrderEncoding(t *testing.T) {
+	byTag := func(field string, padLength int) Index {
+		i := ByEquality(field)
+		i.Order.FieldName = "tag"
+		i.StringOrderPadLength = padLength
+		return i
+	}
+	table := New(fs.NewStore(), User{}, Indexes(byTag("age", 16), byTag("created", 32)), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	err := table.Save(User{ID: "1", Tag: "go", Age: 30, Created: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := And(Equals("age", 30), Equals("created", 1))
+	plan, err := table.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the order keys differ in length so they can't be merged
+	if plan.Merge {
+		t.Fatal(plan)
+	}
+	results := []User{}
+	err = table.List(q, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatal(results)
+	}
+}
+
+func TestOr(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag"), ByEquality("age")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	users := []User{
+		{ID: "1", Tag: "rust", Age: 30},
+		{ID: "2", Tag: "go", Age: 31},
+		{ID: "3", Tag: "c", Age: 30},
+		{ID: "4", Tag: "go", Age: 32},
+	}
+	for _, user := range users {
+		err := table.Save(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := []User{}
+	err := table.List(In("tag", "rust", "go"), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ordered by tag
+	if len(results) != 3 || results[0].ID != "2" || results[1].ID != "4" || results[2].ID != "1" {
+		t.Fatal(results)
+	}
+
+	err = table.List(In("ID", "3", "1", "5"), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != "1" || results[1].ID != "3" {
+		t.Fatal(results)
+	}
+
+	// user 1 matches both queries but is returned once,
+	// ordered by age as the first query
+	q := Or(Equals("age", 30), Equals("tag", "rust"), Equals("tag", "go"))
+	plan, err := table.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Union || !plan.Sort || len(plan.Plans) != 3 {
+		t.Fatal(plan)
+	}
+	err = table.List(q, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 || results[0].ID != "1" || results[1].ID != "3" || results[3].ID != "4" {
+		t.Fatal(results)
+	}
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// jsonNames returns the json names of the fields of a struct type,
+// fields can be listed by field name or json name.
+// The returned set is cached and must not be modified.
+func jsonNames(typ reflect.Type, fields []string) (map[string]bool, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	k := fieldKey{typ, strings.Join(fields, ",")}
+	if names, ok := jsonNameSets.Load(k); ok {
+		return names.(map[string]bool), nil
+	}
+	names := map[string]bool{}
+	for _, field := range fields {
+		fieldName, err := structFieldName(typ, field)
+		if err != nil {
+			return nil, err
+		}
+		f, _ := typ.FieldByName(fieldName)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	jsonNameSets.Store(k, names)
+	return names, nil
+}
+
+// project keeps only the given top level keys of a json document
+func project(value []byte, names map[string]bool) ([]byte, error) {
+	doc := map[string]json.RawMessage{}
+	err := json.Unmarshal(value, &doc)
+	if err != nil {
+		return nil, err
+	}
+	for k := range doc {
+		if !names[k] {
+			delete(doc, k)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// projectionOf returns the fields stored in an index with a
+// projection. The id, filter and order fields are always stored.
+func (d *model) projectionOf(i Index) []string {
+	return append([]string{d.options.IdIndex.FieldName, i.FieldName, orderField(i.Order, i.FieldName)}, i.Projection...)
+}
+
+// indexValue returns the value stored in the keys of an index
+func (d *model) indexValue(i Index, value []byte) ([]byte, error) {
+	if len(i.Projection) == 0 {
+		return value, nil
+	}
+	names, err := jsonNames(d.typ, d.projectionOf(i))
+	if err != nil {
+		return nil, err
+	}
+	return project(value, names)
+}
+
+// covers returns true if the index stores all the fields
+// selected by the query
+func (d *model) covers(i Index, query Query) bool {
+	if len(i.Projection) == 0 {
+		return true
+	}
+	if len(query.Fields) == 0 {
+		return false
+	}
+	stored, err := jsonNames(d.typ, d.projectionOf(i))
+	if err != nil {
+		return false
+	}
+	selected, err := jsonNames(d.typ, query.Fields)
+	if err != nil {
+		return false
+	}
+	for name := range selected {
+		if !stored[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// projectRecords returns copies of the records with only the
+// fields selected by the query
+func (d *model) projectRecords(recs []*store.Record, query Query) ([]*store.Record, error) {
+	names, err := jsonNames(d.typ, query.Fields)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*store.Record, 0, len(recs))
+	for _, rec := range recs {
+		value, err := project(rec.Value, names)
+		if err != nil {
+			return nil, err
+		}
+		cp := *rec
+		cp.Value = value
+		ret = append(ret, &cp)
+	}
+	return ret, nil
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/store"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+type Article struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+	Created int64  `json:"created"`
+}
+
+func TestProjection(t *testing.T) {
+	s := fs.NewStore()
+	byTag := ByEquality("tag")
+	byTag.Order.FieldName = "created"
+	byTag.Projection = []string{"title"}
+	table := New(s, Article{}, Indexes(byTag), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	err := table.Save(Article{ID: "1", Title: "Hi", Tag: "go", Content: "A long text", Created: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the projection is stored in the tag index
+	db := table.(*model)
+	recs, err := s.Read(db.keyPrefix(byTag), store.ReadPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || string(recs[0].Value) != `{"created":1,"id":"1","tag":"go","title":"Hi"}` {
+		t.Fatal(recs)
+	}
+
+	// queries not selecting fields can't use the projected index
+	articles := []Article{}
+	err = table.List(Equals("tag", "go"), &articles)
+	if err == nil {
+		t.Fatal("Query should not match the projected index")
+	}
+
+	q := Equals("tag", "go")
+	q.Fields = []string{"title", "Created"}
+	err = table.List(q, &articles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].Title != "Hi" || articles[0].Created != 1 ||
+		articles[0].ID != "" || articles[0].Content != "" {
+		t.Fatal(articles)
+	}
+
+	// selecting a field not in the projection
+	q.Fields = []string{"content"}
+	err = table.List(q, &articles)
+	if err == nil {
+		t.Fatal("Query should not match the projected index")
+	}
+
+	// the id index stores the whole record
+	article := Article{}
+	q = Equals("ID", "1")
+	q.Fields = []string{"content"}
+	err = table.Read(q, &article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Content != "A long text" || article.Title != "" {
+		t.Fatal(article)
+	}
+}
+
+func TestProjectionNextToFullIndex(t *testing.T) {
+	byTag := ByEquality("tag")
+	projected := ByEquality("tag")
+	projected.Projection = []string{"title"}
+	if indexPrefix(byTag) == indexPrefix(projected) {
+		t.Fatal("Indexes with and without a projection must not share keys")
+	}
+	table := New(fs.NewStore(), Article{}, Indexes(byTag, projected), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+	})
+	err := table.Save(Article{ID: "1", Title: "Hi", Tag: "go", Content: "A long text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// plain queries read the full index
+	articles := []Article{}
+	err = table.List(Equals("tag", "go"), &articles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].Content != "A long text" {
+		t.Fatal(articles)
+	}
+
+	// queries selecting stored fields read the projection
+	q := Equals("tag", "go")
+	q.Fields = []string{"title"}
+	plan, err := table.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Index.Name() != projected.Name() {
+		t.Fatal(plan)
+	}
+	err = table.List(q, &articles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].Title != "Hi" || articles[0].Content != "" {
+		t.Fatal(articles)
+	}
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// KeyVersion precedes the index name in the keys of models stored in
+// the default table. Keys written before it was added, which had no
+// escaped separators and strings padded with spaces, are moved to the
+// current layout by Reindex.
+const KeyVersion = "v2"
+
+func (d *model) Reindex() (err error) {
+	defer d.observe("reindex", time.Now(), &err)
+	if err := d.check(); err != nil {
+		return err
+	}
+	prefix := d.legacyPrefix(d.options.IdIndex)
+	pageSize := d.pageSize()
+	offset := uint(0)
+	for {
+		recs, err := d.store.Read(prefix, store.ReadPrefix(), store.ReadLimit(pageSize), store.ReadOffset(offset))
+		if err != nil {
+			return err
+		}
+		for _, rec := range recs {
+			if err := d.reindexRecord(rec); err != nil {
+				return err
+			}
+		}
+		offset += uint(len(recs))
+		if uint(len(recs)) < pageSize {
+			break
+		}
+	}
+
+	// the id index goes last, so a failed reindex can be run again
+	for _, index := range append(d.indexes[:len(d.indexes):len(d.indexes)], d.options.IdIndex) {
+		keys, err := d.store.List(store.ListPrefix(d.legacyPrefix(index)))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err = d.store.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reindexRecord saves a record read from the legacy id index with the
+// keys of all indexes, unless it was saved again since the upgrade.
+// Hooks don't run and no events are sent, as the record doesn't change.
+func (d *model) reindexRecord(rec *store.Record) error {
+	entry, err := d.decode(rec)
+	if err != nil {
+		return err
+	}
+	_, err = d.readByID(getFieldValue(entry, d.options.IdIndex.FieldName), reflect.New(d.typ).Interface())
+	if err == nil {
+		return nil
+	}
+	if err != ErrorNotFound {
+		return err
+	}
+	return d.save(entry, nil, d.indexes, d.uniqueChecks(entry, nil), SaveOptions{TTL: rec.Expiry})
+}
+
+// legacyPrefix is the prefix of the keys of an index written before
+// KeyVersion, which were always stored in the default table
+func (d *model) legacyPrefix(i Index) string {
+	i.Projection = nil
+	return fmt.Sprintf("%v:%v:", d.namespace, indexPrefix(i))
+}
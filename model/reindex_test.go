@@ -0,0 +1,64 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/store"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestReindex(t *testing.T) {
+	namespace := uuid.Must(uuid.NewV4()).String()
+	s := fs.NewStore()
+	// keys written before KeyVersion, with strings padded with spaces
+	for key, value := range map[string]string{
+		namespace + ":eqByIDUnordByID:1:1":                `{"id":"1","tag":"hello"}`,
+		namespace + ":eqByTagAscByTag:hello           :1": `{"id":"1","tag":"hello"}`,
+		namespace + ":eqByIDUnordByID:2:2":                `{"id":"2","tag":"stale"}`,
+		namespace + ":eqByTagAscByTag:stale           :2": `{"id":"2","tag":"stale"}`,
+	} {
+		err := s.Write(&store.Record{Key: key, Value: []byte(value)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := New(s, User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: namespace,
+	})
+	user := User{}
+	err := db.Read(Equals("tag", "hello"), &user)
+	if err != ErrorNotFound {
+		t.Fatal(err)
+	}
+	// saved again after the upgrade, the legacy record is skipped
+	err = db.Save(User{ID: "2", Tag: "fresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = db.Reindex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Read(Equals("tag", "hello"), &user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != "1" {
+			t.Fatal(user)
+		}
+		err = db.Read(Equals("tag", "stale"), &user)
+		if err != ErrorNotFound {
+			t.Fatal(err)
+		}
+		keys, err := s.List(store.ListPrefix(namespace + ":eqBy"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 0 {
+			t.Fatal(keys)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+// deletedMetadataKey marks soft deleted records. The value is
+// the unix nano timestamp of the deletion as a string.
+const deletedMetadataKey = "deleted"
+
+func isDeleted(rec *store.Record) bool {
+	if rec == nil || rec.Metadata == nil {
+		return false
+	}
+	_, ok := rec.Metadata[deletedMetadataKey]
+	return ok
+}
+
+func deletedAt(rec *store.Record) (time.Time, error) {
+	nanos, err := strconv.ParseInt(fmt.Sprintf("%v", rec.Metadata[deletedMetadataKey]), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
+
+func withoutDeleted(recs []*store.Record) []*store.Record {
+	ret := []*store.Record{}
+	for _, rec := range recs {
+		if !isDeleted(rec) {
+			ret = append(ret, rec)
+		}
+	}
+	return ret
+}
+
+// readByID reads the record by id into entry, soft deleted records included.
+func (d *model) readByID(id interface{}, entry interface{}) (*store.Record, error) {
+	q := d.options.IdIndex.ToQuery(id)
+	q.IncludeDeleted = true
+	recs, err := d.read(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, ErrorNotFound
+	}
+	if len(recs) > 1 {
+		return nil, ErrorMultipleRecordsFound
+	}
+	return recs[0], json.Unmarshal(recs[0].Value, entry)
+}
+
+// rewrite writes all index keys of an entry with the same value
+// but different metadata, ie. to mark it deleted or restore it.
+func (d *model) rewrite(entry interface{}, value []byte, metadata map[string]interface{}, ttl time.Duration) error {
+	id := getFieldValue(entry, d.options.IdIndex.FieldName)
+	for _, index := range append(d.indexes[:len(d.indexes):len(d.indexes)], d.options.IdIndex) {
+		k := d.indexToKey(index, id, entry, true)
+		v, err := d.indexValue(index, value)
+		if err != nil {
+			return err
+		}
+		err = d.storeWrite(index, &store.Record{
+			Key:      k,
+			Value:    v,
+			Metadata: metadata,
+			Expiry:   ttl,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *model) Restore(query Query) (err error) {
+	defer d.observe("restore", time.Now(), &err)
+	if d.options.IdIndex.FieldName != query.FieldName ||
+		d.options.IdIndex.Type != query.Type {
+		return errors.New("Restore query does not match default index")
+	}
+	entry := reflect.New(d.typ).Interface()
+	rec, err := d.readByID(query.Value, entry)
+	if err != nil {
+		return err
+	}
+	if !isDeleted(rec) {
+		return ErrorNotFound
+	}
+	err = d.rewrite(entry, rec.Value, nil, rec.Expiry)
+	if err != nil {
+		return err
+	}
+	// a restored record appears again to readers
+	d.notify(EventTypeCreate, entry, nil)
+	return nil
+}
+
+func (d *model) Purge(olderThan time.Duration) (err error) {
+	defer d.observe("purge", time.Now(), &err)
+	q := d.options.IdIndex.ToQuery(nil)
+	q.IncludeDeleted = true
+	recs, err := d.read(q)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	for _, rec := range recs {
+		if !isDeleted(rec) {
+			continue
+		}
+		at, err := deletedAt(rec)
+		if err != nil {
+			return err
+		}
+		if at.After(cutoff) {
+			continue
+		}
+		entry := reflect.New(d.typ).Interface()
+		err = json.Unmarshal(rec.Value, entry)
+		if err != nil {
+			return err
+		}
+		err = d.deleteKeys(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
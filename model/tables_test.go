@@ -0,0 +1,98 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/context/metadata"
+	"github.com/micro/micro/v3/service/store"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestTables(t *testing.T) {
+	s := fs.NewStore()
+	name := "users_" + uuid.Must(uuid.NewV4()).String()
+	table := New(s, User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Database: "blog",
+		Table:    name,
+	})
+	err := table.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := s.List(store.ListFrom("blog", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys are not prefixed with the namespace
+	if len(keys) != 2 || !strings.HasPrefix(keys[0], indexPrefix(table.(*model).options.IdIndex)) {
+		t.Fatal(keys)
+	}
+
+	users := []User{}
+	err = table.List(Equals("tag", "go"), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != "1" {
+		t.Fatal(users)
+	}
+}
+
+func TestTablePerIndex(t *testing.T) {
+	s := fs.NewStore()
+	name := "users_" + uuid.Must(uuid.NewV4()).String()
+	table := New(s, User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Table:         name,
+		TablePerIndex: true,
+		Tenant:        TenantFromMetadata("Micro-Namespace"),
+	})
+	blogA := table.WithContext(metadata.Set(context.Background(), "Micro-Namespace", "a"))
+	err := blogA.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = blogA.Update(User{ID: "1", Tag: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagIndex := ByEquality("tag")
+	keys, err := s.List(store.ListFrom("", name+"_"+indexPrefix(tagIndex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], "a:rust") {
+		t.Fatal(keys)
+	}
+	user := User{}
+	err = blogA.Read(Equals("tag", "rust"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Tag != "rust" {
+		t.Fatal(user)
+	}
+
+	tenants, err := table.Tenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 1 || tenants[0] != "a" {
+		t.Fatal(tenants)
+	}
+	err = table.DropTenant("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err = s.List(store.ListFrom("", name+"_"+indexPrefix(table.(*model).options.IdIndex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatal(keys)
+	}
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/micro/micro/v3/service/auth"
+	"github.com/micro/micro/v3/service/context/metadata"
+	"github.com/micro/micro/v3/service/store"
+)
+
+var ErrorNoTenant = errors.New("no tenant found in context")
+
+// TenantResolver returns the tenant of a context.
+// Keys of each tenant are prefixed with the tenant after the
+// namespace of the model, so tenants are strictly isolated.
+type TenantResolver func(ctx context.Context) (string, error)
+
+// TenantFromMetadata resolves the tenant from a metadata key
+// of the context, ie. "Micro-Namespace"
+func TenantFromMetadata(key string) TenantResolver {
+	return func(ctx context.Context) (string, error) {
+		tenant, ok := metadata.Get(ctx, key)
+		if !ok || len(tenant) == 0 {
+			return "", ErrorNoTenant
+		}
+		return tenant, nil
+	}
+}
+
+// TenantFromAccount resolves the tenant from the issuer of the
+// micro account of the context
+func TenantFromAccount() TenantResolver {
+	return func(ctx context.Context) (string, error) {
+		acc, ok := auth.AccountFromContext(ctx)
+		if !ok || len(acc.Issuer) == 0 {
+			return "", ErrorNoTenant
+		}
+		return acc.Issuer, nil
+	}
+}
+
+// resolveTenant sets the tenant of the model based on its context.
+// Failures are saved and returned by every store call, so operations
+// never fall back to keys shared between tenants.
+func (d *model) resolveTenant() {
+	if d.options.Tenant == nil {
+		return
+	}
+	d.tenant, d.tenantErr = d.options.Tenant(d.ctx)
+}
+
+// tenantNamespace is the namespace of the model
+// joined with the tenant, if the model has tenants
+func (d *model) tenantNamespace() string {
+	if d.options.Tenant == nil {
+		return d.namespace
+	}
+	return fmt.Sprintf("%v:%v", d.namespace, escapeKey(d.tenant))
+}
+
+// tenantsPrefix is the part of the keys before the tenant
+func (d *model) tenantsPrefix() string {
+	if len(d.options.Table) > 0 {
+		return ""
+	}
+	return d.namespace + ":"
+}
+
+// Tenants lists the tenants having keys in the store.
+// @todo this lists all keys of the model, keep a tenant list
+// if it gets slow.
+func (d *model) Tenants() ([]string, error) {
+	if d.options.Tenant == nil {
+		return nil, errors.New("Model has no tenant resolver")
+	}
+	// every record has a key in the id index
+	db, table := d.tableOf(d.options.IdIndex)
+	prefix := d.tenantsPrefix()
+	keys, err := d.store.List(store.ListPrefix(prefix), store.ListFrom(db, table))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	tenants := []string{}
+	for _, key := range keys {
+		tenant := unescapeKey(strings.SplitN(strings.TrimPrefix(key, prefix), ":", 2)[0])
+		if !seen[tenant] {
+			seen[tenant] = true
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// DropTenant deletes all keys of a tenant
+func (d *model) DropTenant(tenant string) error {
+	if d.options.Tenant == nil {
+		return errors.New("Model has no tenant resolver")
+	}
+	if len(tenant) == 0 {
+		return fmt.Errorf("Invalid tenant '%v'", tenant)
+	}
+	prefix := fmt.Sprintf("%v%v:", d.tenantsPrefix(), escapeKey(tenant))
+	for _, t := range d.tables() {
+		keys, err := d.store.List(store.ListPrefix(prefix), store.ListFrom(t[0], t[1]))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err = d.store.Delete(key, store.DeleteFrom(t[0], t[1]))
+			if err != nil {
+				return err
+			}
+		}
+		if d.options.Cache != nil {
+			d.options.Cache.invalidatePrefix(tableCacheKey(t[0], t[1], prefix))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/context/metadata"
+	fs "github.com/micro/micro/v3/service/store/file"
+)
+
+func TestTenants(t *testing.T) {
+	table := New(fs.NewStore(), User{}, Indexes(ByEquality("tag")), &ModelOptions{
+		Namespace: uuid.Must(uuid.NewV4()).String(),
+		Tenant:    TenantFromMetadata("Micro-Namespace"),
+	})
+	err := table.Save(User{ID: "1", Tag: "go"})
+	if err != ErrorNoTenant {
+		t.Fatal(err)
+	}
+
+	blogA := table.WithContext(metadata.Set(context.Background(), "Micro-Namespace", "a"))
+	blogB := table.WithContext(metadata.Set(context.Background(), "Micro-Namespace", "b"))
+	err = blogA.Save(User{ID: "1", Tag: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = blogB.Save(User{ID: "1", Tag: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []User{}
+	err = blogA.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Tag != "go" {
+		t.Fatal(users)
+	}
+
+	tenants, err := table.Tenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 2 || tenants[0] != "a" || tenants[1] != "b" {
+		t.Fatal(tenants)
+	}
+	err = table.DropTenant("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = blogA.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Fatal(users)
+	}
+	err = blogB.List(Equals("tag", nil), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatal(users)
+	}
+}
+
+func TestDropTenantCache(t *testing.T) {
+	for _, tableName := range []string{"", "users"} {
+		cache := NewCache(10, 0)
+		table := New(fs.NewStore(), User{}, nil, &ModelOptions{
+			Namespace: uuid.Must(uuid.NewV4()).String(),
+			Table:     tableName,
+			Tenant:    TenantFromMetadata("Micro-Namespace"),
+			Cache:     cache,
+		})
+		blogA := table.WithContext(metadata.Set(context.Background(), "Micro-Namespace", "a"))
+		blogB := table.WithContext(metadata.Set(context.Background(), "Micro-Namespace", "b"))
+		user := User{}
+		for _, blog := range []Model{blogA, blogB} {
+			err := blog.Save(User{ID: "1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// cache the read
+			err = blog.Read(Equals("ID", "1"), &user)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := table.DropTenant("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = blogA.Read(Equals("ID", "1"), &user)
+		if err != ErrorNotFound {
+			t.Fatalf("Table '%v': expected reads of a dropped tenant to miss the cache, got %v", tableName, err)
+		}
+		hits := cache.Stats().Hits
+		err = blogB.Read(Equals("ID", "1"), &user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cache.Stats().Hits != hits+1 {
+			t.Fatalf("Table '%v': reads of other tenants should stay cached", tableName)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/logger"
+)
+
+type EventType string
+
+const (
+	EventTypeCreate = EventType("create")
+	EventTypeUpdate = EventType("update")
+	EventTypeDelete = EventType("delete")
+)
+
+// Event describes a change of a record
+type Event struct {
+	Type EventType `json:"type"`
+	// Record is a pointer to a copy of the created, updated or deleted record
+	Record interface{} `json:"record"`
+	// Old is the record before an update
+	Old interface{} `json:"old,omitempty"`
+	// Tenant of the record for models with a tenant resolver
+	Tenant    string    `json:"tenant,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Publisher publishes model events to a stream.
+// It is implemented by micro's events.Stream, use the memory
+// stream (events/stream/memory) in tests.
+type Publisher interface {
+	Publish(topic string, msg interface{}, opts ...events.PublishOption) error
+}
+
+// WatchBufferSize is the number of events a watcher can fall behind.
+// Watchers falling further behind are stopped, closing their channel.
+const WatchBufferSize = 64
+
+// Watcher delivers the events of records matching a query
+type Watcher interface {
+	// Chan returns the channel events are delivered on.
+	// The channel gets closed when the watcher is stopped.
+	Chan() <-chan Event
+	Stop()
+}
+
+type watcher struct {
+	id       string
+	tenant   string
+	query    Query
+	events   chan Event
+	exit     chan bool
+	once     sync.Once
+	watchers *watchers
+}
+
+type watchers struct {
+	sync.RWMutex
+	m map[string]*watcher
+}
+
+func (w *watcher) Chan() <-chan Event {
+	return w.events
+}
+
+func (w *watcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+		w.watchers.Lock()
+		delete(w.watchers.m, w.id)
+		close(w.events)
+		w.watchers.Unlock()
+	})
+}
+
+// Watch only sees changes made through this model instance,
+// use the Stream option to get notified of changes made by other services.
+// Watchers more than WatchBufferSize events behind are stopped.
+func (d *model) Watch(query Query) (Watcher, error) {
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	if query.FieldName != "" {
+		if _, err := structFieldName(d.typ, query.FieldName); err != nil {
+			return nil, err
+		}
+	}
+	w := &watcher{
+		id:       uuid.Must(uuid.NewV4()).String(),
+		tenant:   d.tenant,
+		query:    query,
+		events:   make(chan Event, WatchBufferSize),
+		exit:     make(chan bool),
+		watchers: d.watchers,
+	}
+	d.watchers.Lock()
+	d.watchers.m[w.id] = w
+	d.watchers.Unlock()
+
+	if d.ctx.Done() != nil {
+		go func() {
+			select {
+			case <-d.ctx.Done():
+				w.Stop()
+			case <-w.exit:
+			}
+		}()
+	}
+	return w, nil
+}
+
+// matches returns true if the record matches the query of the watcher.
+// A query without a value matches every record.
+func (w *watcher) matches(record interface{}) bool {
+	if record == nil {
+		return false
+	}
+	return queryMatches(w.query, record)
+}
+
+func queryMatches(q Query, record interface{}) bool {
+	if q.Type == queryTypeAnd {
+		for _, sub := range q.Queries {
+			if !queryMatches(sub, record) {
+				return false
+			}
+		}
+		return true
+	}
+	if q.Type == queryTypeOr {
+		for _, sub := range q.Queries {
+			if queryMatches(sub, record) {
+				return true
+			}
+		}
+		return false
+	}
+	if q.Value == nil || q.FieldName == "" {
+		return true
+	}
+	fieldName, err := structFieldName(reflect.TypeOf(record), q.FieldName)
+	if err != nil {
+		return false
+	}
+	return fieldEquals(record, fieldName, q.Value)
+}
+
+// notify sends the event to the watchers with a matching query
+// and publishes it to the stream if one is set up.
+// The change is already stored, so failing to publish is logged and
+// reported to the metrics as a "publish" operation instead of failing it.
+func (d *model) notify(typ EventType, record, old interface{}) {
+	d.watchers.RLock()
+	watching := len(d.watchers.m) > 0
+	d.watchers.RUnlock()
+	if !watching && d.options.Stream == nil {
+		return
+	}
+	// the caller keeps using the record, so watchers and the stream get a copy
+	cp, err := copyRecord(record)
+	if err != nil {
+		d.logger().Fields(map[string]interface{}{"model": d.namespace}).Logf(logger.ErrorLevel, "Copying %v event record failed: %v", typ, err)
+		return
+	}
+	event := Event{
+		Type:      typ,
+		Record:    cp,
+		Old:       old,
+		Tenant:    d.tenant,
+		Timestamp: time.Now(),
+	}
+
+	// sends never block, so slow watchers can't hold up writes
+	overflown := []*watcher{}
+	d.watchers.RLock()
+	for _, w := range d.watchers.m {
+		if w.tenant != d.tenant {
+			continue
+		}
+		// updates moving a record out of the query are delivered too
+		if !w.matches(record) && !w.matches(old) {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			overflown = append(overflown, w)
+		}
+	}
+	d.watchers.RUnlock()
+	for _, w := range overflown {
+		d.logger().Fields(map[string]interface{}{"model": d.namespace}).Logf(logger.WarnLevel, "Stopping watcher %v, more than %v events behind", w.id, WatchBufferSize)
+		w.Stop()
+	}
+
+	if d.options.Stream == nil {
+		return
+	}
+	topic := d.options.Topic
+	if len(topic) == 0 {
+		topic = d.namespace
+	}
+	defer d.observe("publish", time.Now(), &err)
+	err = d.options.Stream.Publish(topic, event)
+	if err != nil {
+		d.logger().Fields(map[string]interface{}{"model": d.namespace, "topic": topic}).Logf(logger.ErrorLevel, "Publishing %v event failed: %v", typ, err)
+	}
+}
+
+// copyRecord returns a pointer to a deep copy of a record,
+// made by encoding it the way it is stored
+func copyRecord(record interface{}) (interface{}, error) {
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	cp := reflect.New(reflect.Indirect(reflect.ValueOf(record)).Type())
+	return cp.Interface(), json.Unmarshal(bs, cp.Interface())
+}